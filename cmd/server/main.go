@@ -89,6 +89,40 @@ func main() {
 				WithForeignKeys().
 				Exec(ctx),
 		)
+		utils.MustExec(
+			db.
+				NewCreateTable().
+				Model(&mailmodels.Settings{}).
+				WithForeignKeys().
+				Exec(ctx),
+		)
+		utils.MustExec(
+			db.
+				NewCreateTable().
+				Model(&mailmodels.Extractor{}).
+				WithForeignKeys().
+				Exec(ctx),
+		)
+		utils.MustExec(
+			db.
+				NewCreateTable().
+				Model(&mailmodels.SenderFilter{}).
+				WithForeignKeys().
+				Exec(ctx),
+		)
+		utils.MustExec(
+			db.
+				NewCreateTable().
+				Model(&mailmodels.Domain{}).
+				WithForeignKeys().
+				Exec(ctx),
+		)
+		if err := mailmodels.CreateDomainIndex(ctx, db); err != nil {
+			log.Panicf("could not create domain index: %v", err)
+		}
+		if err := mailmodels.CreateSearchIndex(ctx, db); err != nil {
+			log.Panicf("could not create search index: %v", err)
+		}
 		utils.MustExec(
 			db.
 				NewCreateTable().
@@ -118,7 +152,7 @@ func main() {
 		slog.Info("enabling app", "name", name)
 	}
 	for _, app := range apps {
-		app.Init()
+		app.Init(apps)
 	}
 	for _, app := range apps {
 		defer app.CleanUp()
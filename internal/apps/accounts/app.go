@@ -10,6 +10,7 @@ import (
 	"github.com/charmbracelet/ssh"
 	"github.com/ksdme/mail/internal/apps"
 	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/core"
 	"github.com/ksdme/mail/internal/core/tui/colors"
 	"github.com/ksdme/mail/internal/utils"
 	"github.com/pkg/errors"
@@ -24,7 +25,7 @@ func (a *App) Info() (string, string, string) {
 	return "accounts", "Accounts", "Manage your account."
 }
 
-func (a *App) Init() {
+func (a *App) Init(apps []core.App) {
 }
 
 func (a *App) HandleRequest(
@@ -46,6 +47,15 @@ func (a *App) HandleRequest(
 		}
 
 	case args.Accounts.RemoveKey != nil:
+		remove := utils.AskConsent(
+			session,
+			"This operation will stop the key from logging in to your account.\n"+
+				"Are you sure? (yes/no) ",
+		)
+		if !remove {
+			return 1, fmt.Errorf("aborting key removal operation")
+		}
+
 		err := account.RemoveKey(session.Context(), a.DB, args.Accounts.RemoveKey.Key)
 		if err != nil {
 			return 1, errors.Wrap(err, "could not remove key")
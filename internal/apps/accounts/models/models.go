@@ -258,7 +258,7 @@ func GetAccountFromKey(
 	return &account, nil
 }
 
-// Find an account from the token.
+// Find an account from the token. Tokens that expired are not accepted.
 func GetAccountFromToken(
 	ctx context.Context,
 	db *bun.DB,
@@ -271,6 +271,7 @@ func GetAccountFromToken(
 		Join("JOIN tokens as token").
 		JoinOn("token.account_id = account.id").
 		Where("token.token = ?", token).
+		Where("token.expires IS NULL OR token.expires > ?", time.Now()).
 		Scan(ctx)
 	if err != nil {
 		if err == sql.ErrNoRows {
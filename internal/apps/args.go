@@ -6,7 +6,162 @@ import "time"
 // supported subcommands here.
 type AppArgs struct {
 	// Mail application.
-	Mail *struct{} `arg:"subcommand:mail" help:"a disposable email app"`
+	Mail *struct {
+		Mailboxes *struct{} `arg:"subcommand:mailboxes" help:"list all your mailboxes"`
+
+		Domains *struct {
+			Add *struct {
+				Domain string `arg:"positional,required"`
+			} `arg:"subcommand:add" help:"bring in a domain of your own, it accepts mails once it is verified"`
+
+			Verify *struct {
+				Domain string `arg:"positional,required"`
+			} `arg:"subcommand:verify" help:"check the TXT and MX records on a domain of your own"`
+
+			Remove *struct {
+				Domain string `arg:"positional,required"`
+			} `arg:"subcommand:remove" help:"stop accepting mails on a domain of your own"`
+		} `arg:"subcommand:domains" help:"list or manage the domains mailboxes can be created on"`
+
+		Create *struct {
+			For    string `help:"domain of the site the mailbox is for, used to generate a recognisable name"`
+			Domain string `help:"domain the mailbox receives mails on, one of the domains listed by mail domains"`
+			Label  string `help:"a short label for the mailbox"`
+			Note   string `help:"a free-form note on the mailbox"`
+
+			Expires       time.Duration `help:"delete the mailbox after this duration"`
+			MaxMails      int           `arg:"--max-mails" help:"stop accepting mails after receiving these many mails"`
+			SingleUse     bool          `arg:"--single-use" help:"stop accepting mails after receiving a single mail"`
+			BurnAfterRead bool          `arg:"--burn-after-read" help:"delete mails once they are read"`
+		} `arg:"subcommand:create" help:"create a new mailbox"`
+
+		Describe *struct {
+			Mailbox string  `arg:"positional,required" help:"name or address of the mailbox"`
+			Label   *string `help:"a short label for the mailbox"`
+			Note    *string `help:"a free-form note on the mailbox"`
+		} `arg:"subcommand:describe" help:"update the label or note on a mailbox"`
+
+		Policy *struct {
+			Mailbox       string  `arg:"positional,required" help:"name or address of the mailbox"`
+			Expires       *string `help:"delete the mailbox after this duration from now, or never"`
+			MaxMails      *int    `arg:"--max-mails" help:"stop accepting mails after receiving these many mails, 0 for no limit"`
+			BurnAfterRead *bool   `arg:"--burn-after-read" help:"delete mails once they are read"`
+		} `arg:"subcommand:policy" help:"show or configure the lifecycle policies on a mailbox"`
+
+		Mails *struct {
+			Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+			Thread  int64  `help:"only list the mails on this thread"`
+		} `arg:"subcommand:mails" help:"list the mails in a mailbox along with their thread"`
+
+		Pin *struct {
+			ID int64 `arg:"positional,required" help:"id of the mail"`
+		} `arg:"subcommand:pin" help:"pin a mail, pinned mails are never cleaned up"`
+
+		Unpin *struct {
+			ID int64 `arg:"positional,required" help:"id of the mail"`
+		} `arg:"subcommand:unpin" help:"unpin a mail"`
+
+		Trash *struct{} `arg:"subcommand:trash" help:"list the deleted mails and mailboxes that have not been purged yet"`
+
+		Restore *struct {
+			ID      int64  `arg:"positional" help:"id of the mail"`
+			Mailbox string `help:"name or address of the mailbox, to restore a mailbox instead"`
+		} `arg:"subcommand:restore" help:"bring back a mail or a mailbox from the trash"`
+
+		Retention *struct {
+			Mailbox  string `help:"name or address of the mailbox, otherwise, the account retention is used"`
+			Duration string `arg:"positional" help:"how long mails are kept around, like 72h, or default"`
+		} `arg:"subcommand:retention" help:"show or configure how long mails are kept around"`
+
+		Rules *struct {
+			Put *struct {
+				Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+			} `arg:"subcommand:put" help:"replace the rules on a mailbox with a sieve script read from stdin"`
+
+			Get *struct {
+				Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+			} `arg:"subcommand:get" help:"print the rules on a mailbox"`
+
+			Clear *struct {
+				Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+			} `arg:"subcommand:clear" help:"remove the rules on a mailbox"`
+		} `arg:"subcommand:rules" help:"manage the sieve rules that are run on the mails delivered to a mailbox"`
+
+		Notifications *struct {
+			Protocol string `arg:"positional" help:"escape sequences sent on new mails, one of off, osc9 or osc777"`
+			Bell     *bool  `help:"ring the bell on new mails"`
+		} `arg:"subcommand:notifications" help:"show or configure the desktop notifications the open sessions send on new mails"`
+
+		Search *struct {
+			Query []string `arg:"positional,required" help:"words to look for in the subject, sender and body"`
+			Limit int      `default:"50" help:"maximum number of results"`
+		} `arg:"subcommand:search" help:"search mails across all your mailboxes"`
+
+		Watch *struct {
+			Mailbox string `help:"name or address of the mailbox, otherwise, all mailboxes are watched"`
+		} `arg:"subcommand:watch" help:"print a json line for every new mail until interrupted"`
+
+		Headers *struct {
+			ID int64 `arg:"positional,required" help:"id of the mail"`
+		} `arg:"subcommand:headers" help:"print all the headers on a mail along with its envelope recipient"`
+
+		Lint *struct {
+			ID int64 `arg:"positional,required" help:"id of the mail"`
+		} `arg:"subcommand:lint" help:"list problems with the html of a mail, exits with 1 if there are any errors"`
+
+		Inject *struct {
+			Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+			From    string `help:"address of the sender, otherwise, it is taken from the message"`
+			Subject string `help:"subject of the message, to send a simple message instead of reading one from stdin"`
+			Body    string `help:"text of the message, to send a simple message instead of reading one from stdin"`
+		} `arg:"subcommand:inject|send-test" help:"store a message read from stdin on a mailbox without going over smtp"`
+
+		Assert *struct {
+			Mailbox    string        `arg:"positional,required" help:"name or address of the mailbox"`
+			Subject    string        `help:"regular expression the subject should match"`
+			Body       string        `help:"regular expression the body should match"`
+			From       string        `help:"address or domain of the sender"`
+			Header     []string      `arg:"--header,separate" help:"name of a header that should be present, can be repeated"`
+			Attachment string        `help:"file name of an attachment that should be present"`
+			LinkHost   string        `arg:"--link-host" help:"host that at least one of the links should point to"`
+			MaxAge     time.Duration `arg:"--max-age" help:"the mail should have been received within this duration"`
+		} `arg:"subcommand:assert" help:"check that a mail matching all the assertions was received, exits with 1 otherwise"`
+
+		Otp *struct {
+			Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+		} `arg:"subcommand:otp" help:"print the latest one-time code received on a mailbox"`
+
+		ListExtractors *struct{} `arg:"subcommand:list-extractors" help:"list the patterns used to find one-time codes from specific senders"`
+
+		AddExtractor *struct {
+			Sender  string `arg:"positional,required" help:"address or domain of the sender"`
+			Pattern string `arg:"positional,required" help:"regular expression matching the code, the first capture group is used if present"`
+		} `arg:"subcommand:add-extractor" help:"add a pattern used to find one-time codes from a sender"`
+
+		RemoveExtractor *struct {
+			ID int64 `arg:"positional,required" help:"id of the extractor"`
+		} `arg:"subcommand:remove-extractor" help:"remove a pattern used to find one-time codes"`
+
+		Senders *struct {
+			Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+		} `arg:"subcommand:senders" help:"list the senders allowed or blocked on a mailbox"`
+
+		Allow *struct {
+			Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+			Sender  string `arg:"positional,required" help:"address or domain of the sender"`
+		} `arg:"subcommand:allow" help:"only accept mails from the allowed senders on a mailbox"`
+
+		Block *struct {
+			Mailbox string `arg:"positional,required" help:"name or address of the mailbox"`
+			Sender  string `arg:"positional,required" help:"address or domain of the sender"`
+		} `arg:"subcommand:block|deny" help:"reject mails from a sender on a mailbox"`
+
+		RemoveSender *struct {
+			ID int64 `arg:"positional,required" help:"id of the allowed or blocked sender"`
+		} `arg:"subcommand:remove-sender" help:"stop allowing or blocking a sender"`
+
+		Leaks *struct{} `arg:"subcommand:leaks" help:"list mails that arrived from senders unrelated to the site a mailbox was created for"`
+	} `arg:"subcommand:mail" help:"a disposable email app"`
 
 	// Clipboard application.
 	Clipboard *struct {
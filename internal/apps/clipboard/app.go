@@ -17,6 +17,7 @@ import (
 	"github.com/ksdme/mail/internal/apps/clipboard/models"
 	"github.com/ksdme/mail/internal/apps/clipboard/tui"
 	"github.com/ksdme/mail/internal/config"
+	"github.com/ksdme/mail/internal/core"
 	"github.com/ksdme/mail/internal/core/tui/colors"
 	"github.com/ksdme/mail/internal/utils"
 	"github.com/pkg/errors"
@@ -32,7 +33,7 @@ func (a *App) Info() (string, string, string) {
 	return "clipboard", "Clipboard", description
 }
 
-func (a *App) Init() {
+func (a *App) Init(apps []core.App) {
 	slog.Debug("initializing clipboard")
 
 	// Set up clean up.
@@ -84,22 +85,10 @@ func (a *App) HandleRequest(
 		if err != nil {
 			return 1, errors.Wrap(err, "could not read contents")
 		}
-		if len(value) > config.Clipboard.MaxContentSize {
-			return 1, fmt.Errorf(
-				"could not put on the clipboard: contents exceed the max size limit of %d bytes",
-				config.Clipboard.MaxContentSize,
-			)
-		}
-		if !utf8.Valid(value) {
-			return 1, fmt.Errorf(
-				"could not put on the clipboard: contents are not a text string",
-			)
-		}
 
 		// Save the value.
-		err = models.CreateClipboardItem(session.Context(), a.DB, value, account)
-		if err != nil {
-			return 1, errors.Wrap(err, "could not put on the clipboard")
+		if err := a.Copy(session.Context(), account, value); err != nil {
+			return 1, err
 		}
 
 		return 0, nil
@@ -131,6 +120,28 @@ func (a *App) HandleRequest(
 	}
 }
 
+// Validates and puts the value on the clipboard of the account. This lets
+// the other apps put contents on the clipboard.
+func (a *App) Copy(ctx context.Context, account accounts.Account, value []byte) error {
+	if len(value) > config.Clipboard.MaxContentSize {
+		return fmt.Errorf(
+			"could not put on the clipboard: contents exceed the max size limit of %d bytes",
+			config.Clipboard.MaxContentSize,
+		)
+	}
+	if !utf8.Valid(value) {
+		return fmt.Errorf(
+			"could not put on the clipboard: contents are not a text string",
+		)
+	}
+
+	err := models.CreateClipboardItem(ctx, a.DB, value, account)
+	if err != nil {
+		return errors.Wrap(err, "could not put on the clipboard")
+	}
+	return nil
+}
+
 func (a *App) HandleApp(
 	session ssh.Session,
 	account accounts.Account,
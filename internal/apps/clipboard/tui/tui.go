@@ -14,6 +14,7 @@ import (
 	"github.com/ksdme/mail/internal/apps/clipboard/events"
 	"github.com/ksdme/mail/internal/apps/clipboard/models"
 	"github.com/ksdme/mail/internal/core/tui/colors"
+	"github.com/ksdme/mail/internal/core/tui/components/confirm"
 	"github.com/ksdme/mail/internal/core/tui/components/help"
 	"github.com/ksdme/mail/internal/utils"
 	"github.com/muesli/reflow/wordwrap"
@@ -29,7 +30,8 @@ type Model struct {
 	db      *bun.DB
 	account accounts.Account
 
-	item *models.DecodedClipboardItem
+	item    *models.DecodedClipboardItem
+	confirm confirm.Model
 
 	width  int
 	height int
@@ -53,7 +55,8 @@ func NewModel(
 		db:      db,
 		account: account,
 
-		item: nil,
+		item:    nil,
+		confirm: confirm.NewModel(renderer, palette),
 
 		renderer: renderer,
 		palette:  palette,
@@ -75,15 +78,43 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+
+		// Matches the layout of the contents in the view.
+		m.confirm.X = 6
+		m.confirm.Y = 1
+		m.confirm.Width = m.width - 12
+		m.confirm.Height = m.height - 4
+		return m, nil
+
+	case confirm.AskMsg:
+		m.confirm.Show(msg)
 		return m, nil
 
+	case tea.MouseMsg:
+		var cmd tea.Cmd
+		m.confirm, cmd = m.confirm.Update(msg)
+		return m, cmd
+
 	case tea.KeyMsg:
+		if m.confirm.Active() {
+			var cmd tea.Cmd
+			m.confirm, cmd = m.confirm.Update(msg)
+			return m, cmd
+		}
+
 		switch {
 		case key.Matches(msg, m.keymap.Quit):
 			return m, m.quit
 
 		case key.Matches(msg, m.keymap.Clear):
-			return m, m.clearClipboard
+			if m.item != nil {
+				return m, confirm.Ask(
+					"Clear clipboard?",
+					"The contents of your clipboard will be deleted.",
+					"Clear",
+					m.clearClipboard,
+				)
+			}
 		}
 
 	case tea.QuitMsg:
@@ -114,16 +145,18 @@ func (m Model) View() string {
 	height := m.height - 2*yp
 
 	// Help
-	help := help.View(
-		[]key.Binding{m.keymap.Clear, m.keymap.Quit},
-		m.renderer,
-		m.palette,
-	)
+	bindings := []key.Binding{m.keymap.Clear, m.keymap.Quit}
+	if m.confirm.Active() {
+		bindings = m.confirm.Help()
+	}
+	help := help.View(bindings, m.renderer, m.palette)
 	height -= 2
 
 	// Contents
 	var contents string
-	if m.item == nil {
+	if m.confirm.Active() {
+		contents = m.confirm.View()
+	} else if m.item == nil {
 		contents = m.renderer.
 			NewStyle().
 			Height(height).
@@ -4,21 +4,30 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/ssh"
+	imapserver "github.com/emersion/go-imap/server"
 	"github.com/emersion/go-smtp"
 	"github.com/ksdme/mail/internal/apps"
 	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
 	"github.com/ksdme/mail/internal/apps/mail/backend"
 	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/imapd"
 	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/apps/mail/pop3d"
 	"github.com/ksdme/mail/internal/apps/mail/tui"
 	"github.com/ksdme/mail/internal/config"
+	"github.com/ksdme/mail/internal/core"
 	"github.com/ksdme/mail/internal/core/tui/colors"
 	"github.com/ksdme/mail/internal/utils"
+	"github.com/pkg/errors"
 	"github.com/uptrace/bun"
 )
 
@@ -26,6 +35,21 @@ import (
 type App struct {
 	DB     *bun.DB
 	server *smtp.Server
+
+	// Used to verify the custom domains, it defaults to the system resolver.
+	Resolver models.Resolver
+
+	// Optional, only available when an lmtp bind address is configured.
+	lmtp *smtp.Server
+
+	// Optional, only available when an imap bind address is configured.
+	imap *imapserver.Server
+
+	// Optional, only available when a pop3 bind address is configured.
+	pop3 *pop3d.Server
+
+	// Optional, only available when the clipboard app is enabled.
+	clipboard core.Clipboard
 }
 
 func (m *App) Info() (string, string, string) {
@@ -34,7 +58,12 @@ func (m *App) Info() (string, string, string) {
 	return "mail", "Disposable Mailboxes", description
 }
 
-func (m *App) Init() {
+func (m *App) Init(apps []core.App) {
+	m.clipboard, _ = core.Find[core.Clipboard](apps)
+	if m.Resolver == nil {
+		m.Resolver = net.DefaultResolver
+	}
+
 	m.server = smtp.NewServer(backend.NewBackend(m.DB))
 	m.server.Addr = config.Mail.SMTPBindAddr
 	m.server.Domain = config.Mail.MXHost
@@ -47,6 +76,53 @@ func (m *App) Init() {
 		}
 	}()
 
+	// LMTP Server.
+	if config.Mail.LMTPBindAddr != "" {
+		m.lmtp = smtp.NewServer(backend.NewBackend(m.DB))
+		m.lmtp.LMTP = true
+		m.lmtp.Domain = config.Mail.MXHost
+
+		go func() {
+			listener, err := listenLMTP(config.Mail.LMTPBindAddr)
+			if err != nil {
+				panic(fmt.Sprintf("failed listening for lmtp: %v", err))
+			}
+
+			slog.Info("starting lmtp server", "at", config.Mail.LMTPBindAddr)
+			if err := m.lmtp.Serve(listener); err != nil && err != smtp.ErrServerClosed {
+				panic(fmt.Sprintf("failed serving lmtp server: %v", err))
+			}
+		}()
+	}
+
+	// IMAP Server.
+	if config.Mail.IMAPBindAddr != "" {
+		m.imap = imapserver.New(imapd.NewBackend(m.DB))
+		m.imap.Addr = config.Mail.IMAPBindAddr
+		m.imap.AllowInsecureAuth = true
+
+		go func() {
+			slog.Info("starting imap server", "at", config.Mail.IMAPBindAddr)
+			if err := m.imap.ListenAndServe(); err != nil && !errors.Is(err, net.ErrClosed) {
+				panic(fmt.Sprintf("failed serving imap server: %v", err))
+			}
+		}()
+	}
+
+	// POP3 Server.
+	if config.Mail.POP3BindAddr != "" {
+		m.pop3 = pop3d.NewServer(m.DB)
+		m.pop3.Addr = config.Mail.POP3BindAddr
+		m.pop3.Domain = config.Mail.MXHost
+
+		go func() {
+			slog.Info("starting pop3 server", "at", config.Mail.POP3BindAddr)
+			if err := m.pop3.ListenAndServe(); err != nil {
+				panic(fmt.Sprintf("failed serving pop3 server: %v", err))
+			}
+		}()
+	}
+
 	// Mail clean up worker.
 	go func() {
 		for {
@@ -54,6 +130,22 @@ func (m *App) Init() {
 			time.Sleep(time.Hour)
 		}
 	}()
+
+	// Mailbox expiry worker.
+	go func() {
+		for {
+			models.CleanupMailboxes(context.Background(), m.DB)
+			time.Sleep(time.Minute)
+		}
+	}()
+
+	// Trash purge worker.
+	go func() {
+		for {
+			models.PurgeTrash(context.Background(), m.DB)
+			time.Sleep(time.Minute)
+		}
+	}()
 }
 
 func (m *App) HandleRequest(
@@ -67,24 +159,102 @@ func (m *App) HandleRequest(
 	renderer *lipgloss.Renderer,
 	palette colors.ColorPalette,
 ) (int, error) {
-	// TODO: Because the help message will be empty, we should explicitly mention
-	// that the ssh.camp mail is tui only at the moment.
-	// Email at the moment only supports a tui mode.
-	// But, we could show a help message if args has it.
+	switch {
+	case args.Mail.Mailboxes != nil:
+		return m.listMailboxes(session, account)
+
+	case args.Mail.Domains != nil:
+		return m.configureDomains(session, account, args)
+
+	case args.Mail.Create != nil:
+		return m.createMailbox(session, account, args)
+
+	case args.Mail.Describe != nil:
+		return m.describeMailbox(session, account, args)
+
+	case args.Mail.Policy != nil:
+		return m.configurePolicy(session, account, args)
+
+	case args.Mail.Mails != nil:
+		return m.listMails(session, account, args)
+
+	case args.Mail.Pin != nil:
+		return m.pinMail(session, account, args.Mail.Pin.ID, true)
+
+	case args.Mail.Unpin != nil:
+		return m.pinMail(session, account, args.Mail.Unpin.ID, false)
+
+	case args.Mail.Trash != nil:
+		return m.listTrash(session, account)
+
+	case args.Mail.Restore != nil:
+		return m.restoreFromTrash(session, account, args)
+
+	case args.Mail.Retention != nil:
+		return m.configureRetention(session, account, args)
+
+	case args.Mail.Rules != nil:
+		return m.configureRules(session, account, args, interactive)
+
+	case args.Mail.Notifications != nil:
+		return m.configureNotifications(session, account, args)
+
+	case args.Mail.Search != nil:
+		return m.searchMails(session, account, args)
+
+	case args.Mail.Watch != nil:
+		return m.watchMails(session, account, args)
+
+	case args.Mail.Headers != nil:
+		return m.printHeaders(session, account, args)
+
+	case args.Mail.Lint != nil:
+		return m.lintMail(session, account, args)
+
+	case args.Mail.Inject != nil:
+		return m.injectMail(session, account, args, interactive)
+
+	case args.Mail.Assert != nil:
+		return m.assertMails(session, account, args)
+
+	case args.Mail.Otp != nil:
+		return m.printCode(session, account, args)
+
+	case args.Mail.ListExtractors != nil:
+		return m.listExtractors(session, account)
+
+	case args.Mail.AddExtractor != nil:
+		return m.addExtractor(session, account, args)
+
+	case args.Mail.RemoveExtractor != nil:
+		return m.removeExtractor(session, account, args)
+
+	case args.Mail.Senders != nil:
+		return m.listSenders(session, account, args)
+
+	case args.Mail.Allow != nil:
+		return m.filterSender(session, account, args.Mail.Allow.Mailbox, args.Mail.Allow.Sender, true)
+
+	case args.Mail.Block != nil:
+		return m.filterSender(session, account, args.Mail.Block.Mailbox, args.Mail.Block.Sender, false)
+
+	case args.Mail.RemoveSender != nil:
+		return m.removeSender(session, account, args)
+
+	case args.Mail.Leaks != nil:
+		return m.listLeaks(session, account)
+	}
 
 	// Otherwise, complain if we are running in an non-interactive mode.
 	if !interactive {
-		fmt.Fprintln(session, "mail app can only be run interactively")
+		fmt.Fprintln(session, "mail app can only be run interactively without a subcommand")
 		return 1, nil
 	}
 
 	// And, then, run the tea application.
-	defer m.cleanUpSession(account)
-	utils.RunTeaInSession(
-		next,
-		session,
-		tui.NewModel(m.DB, account, renderer, palette, tea.Quit),
-	)
+	model := tui.NewModel(m.DB, account, m.clipboard, renderer, palette, tea.Quit)
+	defer m.cleanUpSession(account, model)
+	utils.RunTeaInSession(next, session, model)
 	return 0, nil
 }
 
@@ -100,20 +270,58 @@ func (a *App) HandleApp(
 	model := tui.NewModel(
 		a.DB,
 		account,
+		a.clipboard,
 		renderer,
 		palette,
 		quit,
 	)
 	cleanup := func() {
-		a.cleanUpSession(account)
+		a.cleanUpSession(account, model)
 	}
 	return model, cleanup
 }
 
-func (a *App) cleanUpSession(account accounts.Account) {
+func (a *App) cleanUpSession(account accounts.Account, model tui.Model) {
 	events.MailboxContentsUpdatedSignal.CleanUp(account.ID)
+	model.CleanUp()
 }
 
 func (m *App) CleanUp() {
 	m.server.Shutdown(context.TODO())
+	if m.lmtp != nil {
+		m.lmtp.Shutdown(context.TODO())
+	}
+	if m.imap != nil {
+		m.imap.Close()
+	}
+	if m.pop3 != nil {
+		m.pop3.Close()
+	}
+}
+
+// Listens on a unix socket if the address is a path prefixed with unix:,
+// otherwise, on the tcp address. Stale sockets from earlier runs are removed.
+func listenLMTP(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		mode, err := strconv.ParseUint(config.Mail.LMTPSocketMode, 8, 32)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid socket mode")
+		}
+
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "could not remove stale socket")
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+
+		// The socket is created with the umask, which is usually too loose.
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			listener.Close()
+			return nil, errors.Wrap(err, "could not change socket mode")
+		}
+		return listener, nil
+	}
+	return net.Listen("tcp", address)
 }
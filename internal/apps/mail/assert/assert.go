@@ -0,0 +1,194 @@
+package assert
+
+import (
+	"fmt"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ksdme/mail/internal/apps/mail/backend"
+	"github.com/ksdme/mail/internal/apps/mail/extract"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+)
+
+// A set of expectations on a received mail. Empty values are not checked.
+type Assertions struct {
+	Subject    *regexp.Regexp
+	Body       *regexp.Regexp
+	From       string
+	Headers    []string
+	Attachment string
+	LinkHost   string
+	MaxAge     time.Duration
+}
+
+// The outcome of a single assertion on a mail.
+type Result struct {
+	Name     string
+	Expected string
+	Actual   string
+	Passed   bool
+}
+
+// Checks all the assertions against the mail.
+func (a Assertions) Check(mail models.Mail) []Result {
+	message, err := backend.ParseMessage(mail.Raw)
+	if err != nil || len(mail.Raw) == 0 {
+		message = &backend.Message{Text: mail.Text}
+	}
+
+	var results []Result
+
+	if a.Subject != nil {
+		results = append(results, Result{
+			Name:     "subject",
+			Expected: fmt.Sprintf("matches /%s/", a.Subject),
+			Actual:   mail.DisplaySubject(),
+			Passed:   a.Subject.MatchString(mail.DisplaySubject()),
+		})
+	}
+
+	if a.Body != nil {
+		body := mail.Text
+		if message.Text != "" {
+			body = message.Text
+		}
+		passed := a.Body.MatchString(body) || (message.HTML != "" && a.Body.MatchString(message.HTML))
+
+		results = append(results, Result{
+			Name:     "body",
+			Expected: fmt.Sprintf("matches /%s/", a.Body),
+			Actual:   summarize(body, 120),
+			Passed:   passed,
+		})
+	}
+
+	if a.From != "" {
+		senders := []string{mail.FromAddress}
+		if from, err := message.Header.AddressList("From"); err == nil {
+			for _, address := range from {
+				senders = append(senders, address.Address)
+			}
+		}
+
+		results = append(results, Result{
+			Name:     "from",
+			Expected: a.From,
+			Actual:   strings.Join(unique(senders), ", "),
+			Passed:   matchesSender(a.From, senders),
+		})
+	}
+
+	for _, name := range a.Headers {
+		values, present := message.Header[textproto.CanonicalMIMEHeaderKey(name)]
+
+		actual := "missing"
+		if present {
+			actual = strings.Join(values, ", ")
+		}
+
+		results = append(results, Result{
+			Name:     fmt.Sprintf("header %s", name),
+			Expected: "present",
+			Actual:   actual,
+			Passed:   present,
+		})
+	}
+
+	if a.Attachment != "" {
+		passed := false
+		for _, name := range message.Attachments {
+			if strings.EqualFold(name, a.Attachment) {
+				passed = true
+			}
+		}
+
+		results = append(results, Result{
+			Name:     "attachment",
+			Expected: a.Attachment,
+			Actual:   describeList(message.Attachments),
+			Passed:   passed,
+		})
+	}
+
+	if a.LinkHost != "" {
+		expected := strings.ToLower(a.LinkHost)
+
+		var hosts []string
+		passed := false
+		for _, link := range extract.Links(message.Text, message.HTML) {
+			host := extract.Host(link)
+			hosts = append(hosts, host)
+			if host == expected || strings.HasSuffix(host, "."+expected) {
+				passed = true
+			}
+		}
+
+		results = append(results, Result{
+			Name:     "link host",
+			Expected: a.LinkHost,
+			Actual:   describeList(unique(hosts)),
+			Passed:   passed,
+		})
+	}
+
+	if a.MaxAge > 0 {
+		age := time.Since(mail.CreatedAt)
+		results = append(results, Result{
+			Name:     "age",
+			Expected: fmt.Sprintf("at most %s", a.MaxAge),
+			Actual:   age.Round(time.Second).String(),
+			Passed:   age <= a.MaxAge,
+		})
+	}
+
+	return results
+}
+
+// Returns a boolean indicating if all the results passed.
+func Passed(results []Result) bool {
+	for _, result := range results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// The expected sender can either be an address or a domain.
+func matchesSender(expected string, senders []string) bool {
+	for _, sender := range senders {
+		if models.MatchesSender(expected, sender) {
+			return true
+		}
+	}
+	return false
+}
+
+func summarize(text string, size int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > size {
+		return string(runes[:size]) + "…"
+	}
+	return text
+}
+
+func describeList(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+	return strings.Join(values, ", ")
+}
+
+func unique(values []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
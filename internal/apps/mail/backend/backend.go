@@ -5,17 +5,40 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"mime"
 	"net/mail"
+	"net/textproto"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/emersion/go-smtp"
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
 	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/extract"
 	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/apps/mail/sieve"
 	"github.com/ksdme/mail/internal/config"
+	"github.com/ksdme/mail/internal/utils"
 	"github.com/pkg/errors"
 	"github.com/uptrace/bun"
 )
 
+var (
+	errDeliveryFailed = &smtp.SMTPError{
+		Code:         451,
+		EnhancedCode: smtp.EnhancedCode{4, 3, 0},
+		Message:      "could not deliver the mail, try again later",
+	}
+	errMailboxFull = &smtp.SMTPError{
+		Code:         552,
+		EnhancedCode: smtp.EnhancedCode{5, 2, 2},
+		Message:      "mailbox is not accepting any more mails",
+	}
+
+	errAlreadyRecipient = errors.New("mailbox is already a recipient")
+)
+
 func NewBackend(db *bun.DB) *backend {
 	return &backend{db}
 }
@@ -32,9 +55,22 @@ func (b *backend) NewSession(c *smtp.Conn) (smtp.Session, error) {
 
 // A session on the backend.
 type session struct {
-	db        *bun.DB
-	from      *mail.Address
-	mailboxes []models.Mailbox
+	db         *bun.DB
+	from       *mail.Address
+	recipients []Recipient
+}
+
+// An envelope recipient along with the mailbox it resolved to.
+type Recipient struct {
+	Address string
+	Mailbox models.Mailbox
+
+	// The address exactly as it was given on RCPT, the per-recipient
+	// statuses on LMTP are reported against it.
+	rcpt string
+
+	// Whether the mail was redirected here by the rules on another mailbox.
+	redirected bool
 }
 
 // Handles the MAIL command. It is typically used to indicate whether
@@ -51,7 +87,7 @@ func (s *session) Mail(from string, opts *smtp.MailOptions) error {
 	s.from = address
 
 	host := strings.Split(address.Address, "@")[1]
-	if host == config.Mail.MXHost {
+	if config.Mail.HasDomain(host) {
 		return fmt.Errorf("outgoing email not supported")
 	}
 
@@ -72,20 +108,60 @@ func (s *session) Rcpt(to string, opts *smtp.RcptOptions) error {
 		return errors.Wrap(err, "could not parse recipient address")
 	}
 
-	host := fmt.Sprintf("@%s", config.Mail.MXHost)
-	if !strings.HasSuffix(recipient.Address, host) {
-		return fmt.Errorf("unrecognized domain: %v", recipient.Address)
+	name, host, _ := strings.Cut(recipient.Address, "@")
+
+	var mailbox *models.Mailbox
+	if config.Mail.HasDomain(host) {
+		// Check if such a mailbox already exists.
+		mailbox, err = models.GetOrCreateMailbox(context.Background(), s.db, name, host)
+		if err != nil {
+			return errors.Wrap(err, "could not find a mailbox")
+		}
+	} else {
+		// Otherwise, it could be on a domain brought in by an account.
+		domain, err := models.GetVerifiedDomain(context.Background(), s.db, host)
+		if err != nil {
+			return errors.Wrap(err, "could not find a domain")
+		}
+		if domain == nil {
+			return fmt.Errorf("unrecognized domain: %v", recipient.Address)
+		}
+
+		mailbox, err = domain.Route(context.Background(), s.db, name)
+		if err != nil {
+			return errors.Wrap(err, "could not find a mailbox")
+		}
 	}
-	name := strings.Split(recipient.Address, "@")[0]
 
-	// Check if such a mailbox already exists.
-	mailbox, err := models.GetOrCreateMailbox(context.Background(), s.db, name)
-	if err != nil {
-		return errors.Wrap(err, "could not find a mailbox")
+	if err := mailbox.Accepting(); err != nil {
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 2, 1},
+			Message:      err.Error(),
+		}
+	}
+
+	// Check the sender against the senders allowed or blocked on the mailbox.
+	if s.from != nil {
+		accepted, err := mailbox.AcceptsSender(context.Background(), s.db, s.from.Address)
+		if err != nil {
+			return errors.Wrap(err, "could not check the sender")
+		}
+		if !accepted {
+			return &smtp.SMTPError{
+				Code:         550,
+				EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+				Message:      "sender is not accepted by this mailbox",
+			}
+		}
 	}
 
 	slog.Debug("found matching mailbox", "mailbox", mailbox.ID)
-	s.mailboxes = append(s.mailboxes, *mailbox)
+	s.recipients = append(s.recipients, Recipient{
+		Address: recipient.Address,
+		Mailbox: *mailbox,
+		rcpt:    to,
+	})
 	return nil
 }
 
@@ -93,45 +169,315 @@ func (s *session) Rcpt(to string, opts *smtp.RcptOptions) error {
 // including the headers, subject, body and inline or file attachments.
 // TODO: Check DKIM signature.
 func (s *session) Data(r io.Reader) error {
-	message, _ := mail.ReadMessage(r)
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "could not read message")
+	}
 
-	text, err := extractPlainText(message)
+	// SMTP only has a single reply for all the recipients, so, the mail is
+	// only refused if it could not be stored on any of them.
+	var failure error
+	accepted := false
+	_, err = deliver(
+		context.Background(),
+		s.db,
+		s.from,
+		raw,
+		s.recipients,
+		func(recipient Recipient, err error) {
+			if err == nil {
+				accepted = true
+			} else if failure == nil {
+				failure = err
+			}
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if !accepted && failure != nil {
+		return failure
+	}
+	return nil
+}
+
+// Handles the DATA command on LMTP. Unlike SMTP, the outcome of the delivery
+// is reported for each of the recipients.
+func (s *session) LMTPData(r io.Reader, status smtp.StatusCollector) error {
+	raw, err := io.ReadAll(r)
 	if err != nil {
 		return errors.Wrap(err, "could not read message")
 	}
 
-	for _, mailbox := range s.mailboxes {
+	_, err = deliver(
+		context.Background(),
+		s.db,
+		s.from,
+		raw,
+		s.recipients,
+		func(recipient Recipient, err error) {
+			// Mailboxes the rules redirected to were not on RCPT.
+			if recipient.rcpt != "" {
+				status.SetStatus(recipient.rcpt, err)
+			}
+		},
+	)
+	return err
+}
+
+// Parses the raw message and stores it on the mailbox of each recipient,
+// unless, the mailbox hit its limits. Messages that don't arrive over SMTP should go
+// through this too, so that they are processed exactly like the rest.
+func Deliver(
+	ctx context.Context,
+	db *bun.DB,
+	from *mail.Address,
+	raw []byte,
+	recipients []Recipient,
+) ([]models.Mail, error) {
+	return deliver(ctx, db, from, raw, recipients, func(Recipient, error) {})
+}
+
+// Delivers the message like Deliver does, the status is called once for each
+// recipient with the reason the mail was not stored on it, or, nil.
+func deliver(
+	ctx context.Context,
+	db *bun.DB,
+	from *mail.Address,
+	raw []byte,
+	recipients []Recipient,
+	status func(Recipient, error),
+) ([]models.Mail, error) {
+	message, err := ParseMessage(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read message")
+	}
+	text := extractPlainText(message)
+	links := extract.Links(message.Text, message.HTML)
+
+	messageID := strings.Join(models.ParseMessageIDs(message.Header.Get("Message-Id")), " ")
+	inReplyTo := strings.Join(models.ParseMessageIDs(message.Header.Get("In-Reply-To")), " ")
+	references := strings.Join(models.ParseMessageIDs(message.Header.Get("References")), " ")
+
+	// The message as seen by the rules on the mailboxes.
+	input := sieve.Message{
+		From:   from.Address,
+		Header: mail.Header{},
+		Body:   text,
+		Size:   len(raw),
+	}
+	for _, field := range ParseHeaders(raw) {
+		key := textproto.CanonicalMIMEHeaderKey(field.Name)
+		input.Header[key] = append(input.Header[key], field.Value)
+	}
+
+	// Copied, so that the mailboxes the rules redirect to can be appended
+	// without changing the recipients of the caller.
+	recipients = slices.Clone(recipients)
+
+	var delivered []models.Mail
+	for index := 0; index < len(recipients); index++ {
+		recipient := recipients[index]
+		mailbox := recipient.Mailbox
+
+		// Mails redirected here by another mailbox skip the rules, which
+		// keeps the rules from bouncing mails between mailboxes forever.
+		result := sieve.Result{Keep: true}
+		if mailbox.Rules != "" && !recipient.redirected {
+			input.To = recipient.Address
+			result = runRules(mailbox, input)
+
+			for _, address := range result.Redirects {
+				target, err := redirectTarget(ctx, db, mailbox, from, address, recipients)
+				if err == errAlreadyRecipient {
+					continue
+				} else if err != nil {
+					// The mail is kept instead, so that it is not lost.
+					slog.Info("could not redirect mail", "mailbox", mailbox.ID, "to", address, "err", err)
+					result.Keep = true
+					continue
+				}
+				recipients = append(recipients, Recipient{
+					Address:    target.Email(),
+					Mailbox:    *target,
+					redirected: true,
+				})
+			}
+		}
+		if !result.Keep {
+			slog.Debug("mail was not kept by the rules", "mailbox", mailbox.ID)
+			status(recipient, nil)
+			continue
+		}
+
+		// Senders can have custom patterns configured on the account.
+		patterns, err := models.SenderPatterns(ctx, db, mailbox.AccountID, from.Address)
+		if err != nil {
+			slog.Info("could not query extractors", "mailbox", mailbox.ID, "err", err)
+		}
+
 		mail := &models.Mail{
-			FromAddress: s.from.Address,
-			FromName:    s.from.Name,
+			FromAddress: from.Address,
+			FromName:    from.Name,
 			Subject:     message.Header.Get("Subject"),
 			Text:        text,
+			HTML:        message.HTML,
+			Raw:         raw,
+			EnvelopeTo:  recipient.Address,
+			MessageID:   messageID,
+			InReplyTo:   inReplyTo,
+			References:  references,
+			Link:        extract.VerificationLink(links),
 			MailboxID:   mailbox.ID,
 		}
+		mail.SearchSubject = mail.DisplaySubject()
+		mail.Code = extract.Code(utils.Decode(mail.SearchSubject), text, patterns)
+		applyFlags(mail, result.Flags)
 
-		_, err := s.db.NewInsert().Model(mail).Exec(context.Background())
-		if err != nil {
+		// The delivery is only counted if the mail was stored.
+		err = db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+			if accepted, err := mailbox.RecordDelivery(ctx, tx); err != nil {
+				return err
+			} else if !accepted {
+				return errMailboxFull
+			}
+
+			_, err := tx.NewInsert().Model(mail).Exec(ctx)
+			return err
+		})
+		if err == errMailboxFull {
+			slog.Debug("mailbox hit its limit, dropping mail", "mailbox", mailbox.ID)
+			status(recipient, errMailboxFull)
+		} else if err != nil {
 			slog.Info(
 				"could not add mail to mailbox",
-				"from", s.from.Address,
+				"from", from.Address,
 				"mailbox", mailbox.ID,
 				"err", err,
 			)
+			status(recipient, errDeliveryFailed)
 		} else {
+			status(recipient, nil)
+			if err := mail.AssignThread(ctx, db); err != nil {
+				slog.Info("could not thread mail", "mail", mail.ID, "err", err)
+			}
+
 			slog.Debug(
 				"added mail to mailbox",
-				"from", s.from.Address,
+				"from", from.Address,
 				"mailbox", mailbox.ID,
 			)
+			delivered = append(delivered, *mail)
 
 			events.MailboxContentsUpdatedSignal.Emit(
 				mailbox.AccountID,
 				mailbox.ID,
 			)
+			events.MailReceivedSignal.Emit(
+				mailbox.AccountID,
+				events.MailReceived{
+					ID:          mail.ID,
+					MailboxID:   mailbox.ID,
+					ThreadID:    mail.Thread(),
+					Mailbox:     mailbox.Email(),
+					FromAddress: mail.FromAddress,
+					FromName:    mail.FromName,
+					Subject:     mail.DisplaySubject(),
+					Preview:     makePreview(mail.Text, 200),
+					Code:        mail.Code,
+					Link:        mail.Link,
+					Tags:        strings.Fields(mail.Tags),
+					ReceivedAt:  time.Now().UTC(),
+				},
+			)
 		}
 	}
 
-	return nil
+	return delivered, nil
+}
+
+// Runs the rules on the mailbox against the message. Rules that cannot be
+// parsed anymore are ignored and the mail is kept.
+func runRules(mailbox models.Mailbox, input sieve.Message) sieve.Result {
+	script, err := sieve.Parse(mailbox.Rules)
+	if err != nil {
+		slog.Info("could not parse mailbox rules", "mailbox", mailbox.ID, "err", err)
+		return sieve.Result{Keep: true}
+	}
+	return script.Evaluate(input)
+}
+
+// Finds the mailbox a rule redirects to, it needs to be on the same account
+// and accepting mails from the sender. Mailboxes that are already a recipient
+// are skipped.
+func redirectTarget(
+	ctx context.Context,
+	db *bun.DB,
+	mailbox models.Mailbox,
+	from *mail.Address,
+	address string,
+	recipients []Recipient,
+) (*models.Mailbox, error) {
+	account := accounts.Account{ID: mailbox.AccountID}
+	target, err := models.GetAccountMailbox(ctx, db, account, address)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, recipient := range recipients {
+		if recipient.Mailbox.ID == target.ID {
+			return nil, errAlreadyRecipient
+		}
+	}
+
+	if err := target.Accepting(); err != nil {
+		return nil, err
+	}
+	if accepted, err := target.AcceptsSender(ctx, db, from.Address); err != nil {
+		return nil, errors.Wrap(err, "could not check the sender")
+	} else if !accepted {
+		return nil, fmt.Errorf("sender is not accepted by %s", target.Email())
+	}
+	return target, nil
+}
+
+// Sets the flags from the rules on the mail. \Seen marks it as read and
+// \Flagged stars it, the keywords are kept as tags, and, the rest of the
+// system flags are ignored.
+func applyFlags(mail *models.Mail, flags []string) {
+	var tags []string
+	for _, flag := range flags {
+		switch strings.ToLower(flag) {
+		case `\seen`:
+			mail.Seen = true
+		case `\flagged`:
+			mail.Important = true
+		default:
+			if !strings.HasPrefix(flag, `\`) {
+				tags = append(tags, flag)
+			}
+		}
+	}
+	mail.Tags = strings.Join(tags, " ")
+}
+
+// Decodes the RFC 2047 encoded words on a header value, like the ones on
+// subjects with non-ascii characters.
+func decodeHeader(value string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// Returns the first few characters of the text with the whitespace collapsed.
+func makePreview(text string, size int) string {
+	preview := strings.Join(strings.Fields(text), " ")
+	if runes := []rune(preview); len(runes) > size {
+		preview = string(runes[:size]) + "…"
+	}
+	return preview
 }
 
 // Perform clean up on this session.
@@ -143,7 +489,7 @@ func (s *session) Logout() error {
 // mail transaction. This allows the sender to reuse the connection for sending
 // another email.
 func (s *session) Reset() {
-	var mailboxes []models.Mailbox
-	s.mailboxes = mailboxes
+	var recipients []Recipient
+	s.recipients = recipients
 	s.from = nil
 }
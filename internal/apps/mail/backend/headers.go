@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"net/mail"
+	"slices"
+	"strings"
+)
+
+// A single header on a message.
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Returns all the headers on the raw message in the order they appear in,
+// unlike mail.Header, which loses the order. Folded values are unfolded and
+// encoded words are decoded.
+func ParseHeaders(raw []byte) []HeaderField {
+	var fields []HeaderField
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(raw)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			break
+		}
+
+		// Continuation of the previous header.
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fields) > 0 {
+				last := &fields[len(fields)-1]
+				last.Value += " " + strings.TrimSpace(line)
+			}
+			continue
+		}
+
+		name, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		fields = append(fields, HeaderField{
+			Name:  strings.TrimSpace(name),
+			Value: strings.TrimSpace(value),
+		})
+	}
+
+	for index := range fields {
+		fields[index].Value = decodeHeader(fields[index].Value)
+	}
+	return fields
+}
+
+// The recipients listed on the headers of a message.
+type Recipients struct {
+	To      []*mail.Address
+	Cc      []*mail.Address
+	ReplyTo []*mail.Address
+}
+
+// Returns a boolean indicating if the address is one of the To or Cc
+// recipients. If it is not, the message was likely delivered as a bcc.
+func (r Recipients) Includes(address string) bool {
+	for _, recipient := range slices.Concat(r.To, r.Cc) {
+		if strings.EqualFold(recipient.Address, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parses the recipients on the headers of the message. Malformed address
+// lists are skipped.
+func ParseRecipients(header mail.Header) Recipients {
+	parse := func(name string) []*mail.Address {
+		addresses, _ := header.AddressList(name)
+		return addresses
+	}
+
+	return Recipients{
+		To:      parse("To"),
+		Cc:      parse("Cc"),
+		ReplyTo: parse("Reply-To"),
+	}
+}
@@ -1,11 +1,14 @@
 package backend
 
 import (
+	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
 	"log/slog"
 	"mime"
 	"mime/multipart"
+	"mime/quotedprintable"
 	"net/mail"
 	"strings"
 
@@ -13,6 +16,34 @@ import (
 	"github.com/pkg/errors"
 )
 
+// A parsed message along with the relevant parts of its body.
+type Message struct {
+	Header mail.Header
+
+	// The first text/plain and text/html parts on the message.
+	Text string
+	HTML string
+
+	// The file names of the attachments on the message.
+	Attachments []string
+}
+
+// Parses a raw message.
+func ParseMessage(raw []byte) (*Message, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse message")
+	}
+
+	parsed, err := parseBody(message)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed.Header = message.Header
+	return parsed, nil
+}
+
 // How do we select the relevant message?
 //
 // 1. If the body does not contain multiple parts, the body is returned.
@@ -25,7 +56,29 @@ import (
 //
 // 3. If we have a tracked html part, text-ify and return it
 // 4. Return a string saying "empty body"
-func extractPlainText(message *mail.Message) (string, error) {
+func extractPlainText(message *Message) string {
+	if len(message.Text) > 0 {
+		return message.Text
+	}
+	if len(message.HTML) > 0 {
+		text, err := html2text.FromString(message.HTML, html2text.Options{
+			TextOnly:     false,
+			PrettyTables: false,
+		})
+		if err != nil {
+			slog.Info("could not parse html to text", "err", err)
+			return "could not parse html contents :("
+		} else {
+			return text
+		}
+	}
+
+	return "empty message :("
+}
+
+// Walks the parts on the message body and collects the first text and html
+// parts along with the names of all the attachments.
+func parseBody(message *mail.Message) (*Message, error) {
 	readAll := func(reader io.Reader) (string, error) {
 		if value, err := io.ReadAll(reader); err != nil {
 			return "", errors.Wrap(err, "could not continue reading body")
@@ -34,22 +87,23 @@ func extractPlainText(message *mail.Message) (string, error) {
 		}
 	}
 
-	var text string
-	var html string
-	var resolve func(io.Reader, string, string) error
-	resolve = func(r io.Reader, cType string, cDisposition string) error {
+	parsed := &Message{}
+	var resolve func(io.Reader, string, string, string) error
+	resolve = func(r io.Reader, cType string, cDisposition string, cEncoding string) error {
+		r = decodeTransferEncoding(r, cEncoding)
+
 		// Handles the case where the content type is not available.
 		if cType == "" {
 			slog.Debug("no explicit content type found")
 			if value, err := readAll(r); err != nil {
 				return err
 			} else {
-				text = value
+				parsed.Text = value
 				return nil
 			}
 		}
 
-		// We hate attachments.
+		// We hate attachments, but, we still keep track of them.
 		if cDisposition != "" {
 			label, params, err := mime.ParseMediaType(cDisposition)
 			if err != nil {
@@ -60,10 +114,12 @@ func extractPlainText(message *mail.Message) (string, error) {
 			}
 			if label == "attachment" {
 				slog.Debug("found an attachment, ignoring")
+				parsed.Attachments = append(parsed.Attachments, params["filename"])
 				return nil
 			}
-			if _, ok := params["filename"]; ok {
+			if filename, ok := params["filename"]; ok {
 				slog.Debug("found a filename, assuming attachment, ignoring")
+				parsed.Attachments = append(parsed.Attachments, filename)
 				return nil
 			}
 		}
@@ -88,20 +144,20 @@ func extractPlainText(message *mail.Message) (string, error) {
 				if err == io.EOF {
 					return nil
 				} else if err != nil {
-					continue
+					// A broken part usually means that the rest of the
+					// message cannot be read either.
+					return nil
 				}
 
 				err = resolve(
 					part,
 					part.Header.Get("Content-Type"),
 					part.Header.Get("Content-Disposition"),
+					part.Header.Get("Content-Transfer-Encoding"),
 				)
 				if err != nil {
 					return err
 				}
-				if len(text) > 0 {
-					return nil
-				}
 			}
 		}
 
@@ -110,27 +166,31 @@ func extractPlainText(message *mail.Message) (string, error) {
 		case "":
 		case "text/plain":
 			slog.Debug("found a text/plain part")
-			if value, err := readAll(r); err != nil {
-				return err
-			} else {
-				slog.Debug("")
-				text = value
-				return nil
+			if len(parsed.Text) == 0 {
+				if value, err := readAll(r); err != nil {
+					return err
+				} else {
+					parsed.Text = value
+					return nil
+				}
 			}
 
 		case "text/html":
 			slog.Debug("found a text/html part")
-			if len(html) == 0 {
+			if len(parsed.HTML) == 0 {
 				if value, err := readAll(r); err != nil {
 					return err
 				} else {
-					html = value
+					parsed.HTML = value
 					return nil
 				}
 			}
 
 		default:
 			slog.Debug("found an unrecognized part, ignoring", "type", mediaType)
+			if name, ok := params["name"]; ok {
+				parsed.Attachments = append(parsed.Attachments, name)
+			}
 		}
 
 		return nil
@@ -140,26 +200,48 @@ func extractPlainText(message *mail.Message) (string, error) {
 		message.Body,
 		message.Header.Get("Content-Type"),
 		message.Header.Get("Content-Disposition"),
+		message.Header.Get("Content-Transfer-Encoding"),
 	)
 	if err != nil {
-		return "", nil
+		slog.Debug("could not parse message body", "err", err)
 	}
 
-	if len(text) > 0 {
-		return text, nil
+	return parsed, nil
+}
+
+// Wraps the reader with a decoder based on the transfer encoding. Note that
+// the multipart reader already takes care of quoted printable parts.
+func decodeTransferEncoding(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r})
+
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
 	}
-	if len(html) > 0 {
-		text, err := html2text.FromString(html, html2text.Options{
-			TextOnly:     false,
-			PrettyTables: false,
-		})
-		if err != nil {
-			slog.Info("could not parse html to text", "err", err)
-			return "could not parse html contents :(", nil
-		} else {
-			return text, nil
+
+	return r
+}
+
+// Drops the line breaks in base64 encoded bodies.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		count, err := n.r.Read(p)
+
+		kept := 0
+		for _, value := range p[:count] {
+			if value != '\r' && value != '\n' {
+				p[kept] = value
+				kept += 1
+			}
 		}
-	}
 
-	return "empty message :(", nil
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
 }
@@ -0,0 +1,1095 @@
+package mail
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/ksdme/mail/internal/apps"
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/assert"
+	"github.com/ksdme/mail/internal/apps/mail/backend"
+	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/lint"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/config"
+	"github.com/ksdme/mail/internal/core/tui/notify"
+	"github.com/ksdme/mail/internal/utils"
+	"github.com/pkg/errors"
+)
+
+// The largest message that can be injected into a mailbox.
+const maxMessageSize = 10 * 1024 * 1024
+
+// The largest sieve script that can be put on a mailbox.
+const maxRulesSize = 64 * 1024
+
+// Lists all the mailboxes on the account along with their details.
+func (m *App) listMailboxes(session ssh.Session, account accounts.Account) (int, error) {
+	mailboxes, err := models.ListMailboxes(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, errors.Wrap(err, "could not list mailboxes")
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, mailbox := range mailboxes {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			mailbox.Email(),
+			mailbox.Label,
+			mailbox.Site,
+			describePolicy(mailbox),
+			mailbox.Note,
+		)
+	}
+	w.Flush()
+
+	return 0, nil
+}
+
+// Lists the domains mails are accepted on, or, adds, verifies or removes a
+// domain brought in by the account.
+func (m *App) configureDomains(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	options := args.Mail.Domains
+
+	switch {
+	case options.Add != nil:
+		domain, err := models.CreateDomain(session.Context(), m.DB, account, options.Add.Domain)
+		if err != nil {
+			return 1, err
+		}
+
+		fmt.Fprintf(session, "add these records on %s, then, run mail domains verify %s\n", domain.Name, domain.Name)
+		w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "TXT\t%s\t%s\n", domain.Name, domain.Record())
+		fmt.Fprintf(w, "MX\t%s\t10 %s\n", domain.Name, config.Mail.MXHost)
+		w.Flush()
+		return 0, nil
+
+	case options.Verify != nil:
+		domain, err := models.GetAccountDomain(session.Context(), m.DB, account, options.Verify.Domain)
+		if err != nil {
+			return 1, err
+		}
+		if err := domain.Verify(session.Context(), m.DB, m.Resolver); err != nil {
+			return 1, errors.Wrap(err, "could not verify domain")
+		}
+
+		mailbox, err := domain.Route(session.Context(), m.DB, "")
+		if err != nil {
+			return 1, err
+		}
+		fmt.Fprintf(session, "%s is verified, mails to any address on it land on %s\n", domain.Name, mailbox.Email())
+		return 0, nil
+
+	case options.Remove != nil:
+		domain, err := models.GetAccountDomain(session.Context(), m.DB, account, options.Remove.Domain)
+		if err != nil {
+			return 1, err
+		}
+		if err := domain.Delete(session.Context(), m.DB); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	domains, err := models.ListDomains(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, err
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for index, domain := range config.Mail.Domains() {
+		if index == 0 {
+			fmt.Fprintf(w, "%s\tdefault\n", domain)
+		} else {
+			fmt.Fprintf(w, "%s\t\n", domain)
+		}
+	}
+	for _, domain := range domains {
+		if domain.Verified() {
+			fmt.Fprintf(w, "%s\tverified\n", domain.Name)
+		} else {
+			fmt.Fprintf(w, "%s\tunverified, needs TXT %s\n", domain.Name, domain.Record())
+		}
+	}
+	w.Flush()
+
+	return 0, nil
+}
+
+// Creates a new mailbox, optionally, for a specific site.
+func (m *App) createMailbox(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	create := args.Mail.Create
+
+	// The policy is checked upfront, so that a mailbox is not left behind
+	// without it when it is invalid.
+	if create.Expires < 0 {
+		return 1, fmt.Errorf("invalid expiry: it needs to be positive")
+	}
+	if create.MaxMails < 0 {
+		return 1, fmt.Errorf("invalid max mails: it cannot be negative")
+	}
+
+	var mailbox *models.Mailbox
+	var err error
+	if create.For != "" {
+		mailbox, err = models.CreateSiteMailbox(session.Context(), m.DB, account, create.For, create.Domain)
+	} else {
+		mailbox, err = models.CreateRandomMailbox(session.Context(), m.DB, account, create.Domain)
+	}
+	if err != nil {
+		return 1, errors.Wrap(err, "could not create mailbox")
+	}
+
+	maxMails := create.MaxMails
+	if create.SingleUse {
+		maxMails = 1
+	}
+	var expiresAt time.Time
+	if create.Expires > 0 {
+		expiresAt = time.Now().Add(create.Expires)
+	}
+	if maxMails != 0 || !expiresAt.IsZero() || create.BurnAfterRead {
+		err := mailbox.SetPolicy(session.Context(), m.DB, expiresAt, maxMails, create.BurnAfterRead)
+		if err != nil {
+			return 1, err
+		}
+	}
+
+	label := create.Label
+	if label == "" {
+		label = mailbox.Site
+	}
+	if label != "" || create.Note != "" {
+		if err := mailbox.Describe(session.Context(), m.DB, &label, &create.Note); err != nil {
+			return 1, err
+		}
+	}
+
+	fmt.Fprintln(session, mailbox.Email())
+	return 0, nil
+}
+
+// Updates the label or the note on a mailbox.
+func (m *App) describeMailbox(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	describe := args.Mail.Describe
+
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, describe.Mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	if err := mailbox.Describe(session.Context(), m.DB, describe.Label, describe.Note); err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+// Shows or updates the lifecycle policies on a mailbox.
+func (m *App) configurePolicy(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	policy := args.Mail.Policy
+
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, policy.Mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	// Show the current policy if nothing is being changed.
+	if policy.Expires == nil && policy.MaxMails == nil && policy.BurnAfterRead == nil {
+		fmt.Fprintln(session, describePolicy(*mailbox))
+		return 0, nil
+	}
+
+	expiresAt := mailbox.ExpiresAt
+	if policy.Expires != nil {
+		if *policy.Expires == "never" {
+			expiresAt = time.Time{}
+		} else {
+			duration, err := time.ParseDuration(*policy.Expires)
+			if err != nil {
+				return 1, errors.Wrap(err, "invalid expiry")
+			}
+			if duration <= 0 {
+				return 1, fmt.Errorf("invalid expiry: it needs to be positive")
+			}
+			expiresAt = time.Now().Add(duration)
+		}
+	}
+
+	maxMails := mailbox.MaxMails
+	if policy.MaxMails != nil {
+		maxMails = *policy.MaxMails
+	}
+
+	burnAfterRead := mailbox.BurnAfterRead
+	if policy.BurnAfterRead != nil {
+		burnAfterRead = *policy.BurnAfterRead
+	}
+
+	if err := mailbox.SetPolicy(session.Context(), m.DB, expiresAt, maxMails, burnAfterRead); err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+// Returns a short human readable description of the mailbox policies.
+func describePolicy(mailbox models.Mailbox) string {
+	var policies []string
+	if !mailbox.ExpiresAt.IsZero() {
+		if mailbox.Expired() {
+			policies = append(policies, "expired")
+		} else {
+			policies = append(
+				policies,
+				fmt.Sprintf("expires in %s", utils.RoundedAge(time.Until(mailbox.ExpiresAt))),
+			)
+		}
+	}
+	if mailbox.MaxMails > 0 {
+		policies = append(policies, fmt.Sprintf("%d/%d mails", mailbox.Received, mailbox.MaxMails))
+	}
+	if mailbox.BurnAfterRead {
+		policies = append(policies, "burn after read")
+	}
+
+	if len(policies) == 0 {
+		return "-"
+	}
+	return strings.Join(policies, ", ")
+}
+
+// Lists mails that look like they arrived on leaked addresses.
+func (m *App) listLeaks(session ssh.Session, account accounts.Account) (int, error) {
+	leaks, err := models.FindLeaks(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, errors.Wrap(err, "could not find leaks")
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, leak := range leaks {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\t%s\n",
+			leak.Mail.CreatedAt.Format(time.DateTime),
+			leak.Mailbox.Email(),
+			leak.Site,
+			leak.Mail.FromAddress,
+			utils.Decode(leak.Mail.DisplaySubject()),
+		)
+	}
+	w.Flush()
+
+	return 0, nil
+}
+
+// Lists the mails in a mailbox.
+func (m *App) listMails(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, args.Mail.Mails.Mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	mails, err := models.ListMails(session.Context(), m.DB, *mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, mail := range mails {
+		if thread := args.Mail.Mails.Thread; thread != 0 && mail.Thread() != thread {
+			continue
+		}
+
+		pinned := " "
+		if mail.Important {
+			pinned = "*"
+		}
+
+		// Tags set by the rules on the mailbox follow the subject.
+		subject := utils.Decode(mail.DisplaySubject())
+		if tags := strings.Fields(mail.Tags); len(tags) > 0 {
+			subject = fmt.Sprintf("%s [%s]", subject, strings.Join(tags, ", "))
+		}
+
+		fmt.Fprintf(
+			w,
+			"%d\t%d\t%s\t%s\t%s\t%s\n",
+			mail.ID,
+			mail.Thread(),
+			mail.CreatedAt.Format(time.DateTime),
+			pinned,
+			mail.FromAddress,
+			subject,
+		)
+	}
+	w.Flush()
+
+	return 0, nil
+}
+
+// Searches mails across all the mailboxes on the account.
+func (m *App) searchMails(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	search := args.Mail.Search
+
+	mails, err := models.SearchMails(
+		session.Context(),
+		m.DB,
+		account,
+		strings.Join(search.Query, " "),
+		search.Limit,
+	)
+	if err != nil {
+		return 1, err
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, mail := range mails {
+		fmt.Fprintf(
+			w,
+			"%d\t%d\t%s\t%s\t%s\t%s\n",
+			mail.ID,
+			mail.Thread(),
+			mail.CreatedAt.Format(time.DateTime),
+			mail.Mailbox.Email(),
+			mail.FromAddress,
+			utils.Decode(mail.DisplaySubject()),
+		)
+	}
+	w.Flush()
+
+	if len(mails) == 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Streams newly received mails as json lines until the client disconnects.
+func (m *App) watchMails(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	var mailbox *models.Mailbox
+	if args.Mail.Watch.Mailbox != "" {
+		var err error
+		mailbox, err = models.GetAccountMailbox(session.Context(), m.DB, account, args.Mail.Watch.Mailbox)
+		if err != nil {
+			return 1, err
+		}
+	}
+
+	messages, unsubscribe := events.MailReceivedSignal.Subscribe(account.ID, 64)
+	defer unsubscribe()
+
+	encoder := json.NewEncoder(session)
+	for {
+		select {
+		case <-session.Context().Done():
+			return 0, nil
+
+		case message := <-messages:
+			if mailbox != nil && message.MailboxID != mailbox.ID {
+				continue
+			}
+
+			if err := encoder.Encode(message); err != nil {
+				return 1, errors.Wrap(err, "could not write to the session")
+			}
+		}
+	}
+}
+
+// Prints all the headers on a mail in the order they were received in.
+func (m *App) printHeaders(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	mail, err := models.GetAccountMail(session.Context(), m.DB, account, args.Mail.Headers.ID)
+	if err != nil {
+		return 1, err
+	}
+	if len(mail.Raw) == 0 {
+		return 1, fmt.Errorf("the original message was not kept around for this mail")
+	}
+
+	if mail.EnvelopeTo != "" {
+		fmt.Fprintf(session, "Delivered-To: %s\n", mail.EnvelopeTo)
+	}
+	for _, header := range backend.ParseHeaders(mail.Raw) {
+		fmt.Fprintf(session, "%s: %s\n", header.Name, header.Value)
+	}
+
+	return 0, nil
+}
+
+// Lists the problems with the html of a mail.
+func (m *App) lintMail(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	mail, err := models.GetAccountMail(session.Context(), m.DB, account, args.Mail.Lint.ID)
+	if err != nil {
+		return 1, err
+	}
+
+	report, err := lint.LintMail(*mail)
+	if err != nil {
+		return 1, err
+	}
+
+	if report.HTMLSize == 0 {
+		fmt.Fprintln(session, "not an html mail")
+		return 0, nil
+	}
+
+	fmt.Fprintf(session, "message %s, html %s\n", lint.FormatSize(report.Size), lint.FormatSize(report.HTMLSize))
+	if len(report.Issues) == 0 {
+		fmt.Fprintln(session, "no problems found")
+		return 0, nil
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, issue := range report.Issues {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", issue.Severity, issue.Rule, issue.Message)
+	}
+	w.Flush()
+
+	if report.Failed() {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Stores a message on a mailbox as if it was received over smtp. The message
+// is either read from stdin or built from the subject and the body.
+func (m *App) injectMail(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+	interactive bool,
+) (int, error) {
+	options := args.Mail.Inject
+
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, options.Mailbox)
+	if err != nil {
+		return 1, err
+	}
+	if err := mailbox.Accepting(); err != nil {
+		return 1, err
+	}
+
+	var raw []byte
+	if options.Subject != "" || options.Body != "" {
+		raw = makeMessage(options.From, mailbox.Email(), options.Subject, options.Body)
+	} else {
+		if interactive {
+			return 1, fmt.Errorf("pipe a message into the command, or, use --subject and --body")
+		}
+
+		r := io.LimitReader(session, maxMessageSize+1)
+		raw, err = io.ReadAll(r)
+		if err != nil {
+			return 1, errors.Wrap(err, "could not read message")
+		}
+		if len(raw) > maxMessageSize {
+			return 1, fmt.Errorf("message exceeds the max size limit of %d bytes", maxMessageSize)
+		}
+	}
+
+	// The sender is taken from the message if it was not explicitly set,
+	// like the envelope sender on smtp.
+	sender := options.From
+	if sender == "" {
+		message, err := backend.ParseMessage(raw)
+		if err != nil {
+			return 1, err
+		}
+		sender = message.Header.Get("From")
+	}
+	if sender == "" {
+		sender = defaultInjectSender()
+	}
+
+	from, err := mail.ParseAddress(sender)
+	if err != nil {
+		return 1, errors.Wrap(err, "could not parse from address")
+	}
+
+	recipient := backend.Recipient{Address: mailbox.Email(), Mailbox: *mailbox}
+	mails, err := backend.Deliver(session.Context(), m.DB, from, raw, []backend.Recipient{recipient})
+	if err != nil {
+		return 1, err
+	}
+	if len(mails) == 0 {
+		return 1, fmt.Errorf("message was not accepted by %s", mailbox.Email())
+	}
+
+	for _, mail := range mails {
+		fmt.Fprintln(session, mail.ID)
+	}
+	return 0, nil
+}
+
+// Builds a plain text message.
+func makeMessage(from string, to string, subject string, body string) []byte {
+	if from == "" {
+		from = defaultInjectSender()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "\r\n%s\r\n", body)
+	return []byte(b.String())
+}
+
+func defaultInjectSender() string {
+	return fmt.Sprintf("test@%s", config.Mail.MXHost)
+}
+
+// Checks whether the mailbox received a mail matching all the assertions.
+// When none of them match, the closest recent mails are reported.
+func (m *App) assertMails(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	options := args.Mail.Assert
+
+	assertions := assert.Assertions{
+		From:       options.From,
+		Headers:    options.Header,
+		Attachment: options.Attachment,
+		LinkHost:   options.LinkHost,
+		MaxAge:     options.MaxAge,
+	}
+
+	if options.Subject != "" {
+		pattern, err := regexp.Compile(options.Subject)
+		if err != nil {
+			return 1, errors.Wrap(err, "invalid subject pattern")
+		}
+		assertions.Subject = pattern
+	}
+
+	if options.Body != "" {
+		pattern, err := regexp.Compile(options.Body)
+		if err != nil {
+			return 1, errors.Wrap(err, "invalid body pattern")
+		}
+		assertions.Body = pattern
+	}
+
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, options.Mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	mails, err := models.ListMails(session.Context(), m.DB, *mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	if len(mails) == 0 {
+		fmt.Fprintf(session, "✗ no mails were received on %s\n", mailbox.Email())
+		return 1, nil
+	}
+
+	// Pick the first mail that satisfies all the assertions, and, otherwise,
+	// keep track of the one that came the closest to report on.
+	var closest []assert.Result
+	var closestMail models.Mail
+	best := -1
+	for _, mail := range mails {
+		results := assertions.Check(mail)
+		if assert.Passed(results) {
+			fmt.Fprintf(session, "✓ mail %d matched\n", mail.ID)
+			printAssertions(session, results)
+			return 0, nil
+		}
+
+		passed := 0
+		for _, result := range results {
+			if result.Passed {
+				passed += 1
+			}
+		}
+
+		if passed > best {
+			best = passed
+			closest = results
+			closestMail = mail
+		}
+	}
+
+	fmt.Fprintf(
+		session,
+		"✗ none of the %d mails on %s matched, the closest was mail %d: %s\n",
+		len(mails),
+		mailbox.Email(),
+		closestMail.ID,
+		utils.Decode(closestMail.DisplaySubject()),
+	)
+	printAssertions(session, closest)
+
+	return 1, nil
+}
+
+func printAssertions(session ssh.Session, results []assert.Result) {
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, result := range results {
+		mark := "✓"
+		if !result.Passed {
+			mark = "✗"
+		}
+
+		fmt.Fprintf(w, "  %s\t%s\texpected: %s\n", mark, result.Name, result.Expected)
+		if !result.Passed {
+			fmt.Fprintf(w, "   \t\tactual:   %s\n", result.Actual)
+		}
+	}
+	w.Flush()
+}
+
+// Prints the latest one-time code received on a mailbox.
+func (m *App) printCode(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, args.Mail.Otp.Mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	mail, err := models.LatestCode(session.Context(), m.DB, *mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	fmt.Fprintln(session, mail.Code)
+	return 0, nil
+}
+
+// Lists the code extractors on the account.
+func (m *App) listExtractors(session ssh.Session, account accounts.Account) (int, error) {
+	extractors, err := models.ListExtractors(session.Context(), m.DB, account.ID)
+	if err != nil {
+		return 1, err
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, extractor := range extractors {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", extractor.ID, extractor.Sender, extractor.Pattern)
+	}
+	w.Flush()
+
+	return 0, nil
+}
+
+func (m *App) addExtractor(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	extractor, err := models.CreateExtractor(
+		session.Context(),
+		m.DB,
+		account,
+		args.Mail.AddExtractor.Sender,
+		args.Mail.AddExtractor.Pattern,
+	)
+	if err != nil {
+		return 1, err
+	}
+
+	fmt.Fprintln(session, extractor.ID)
+	return 0, nil
+}
+
+func (m *App) removeExtractor(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	err := models.DeleteExtractor(session.Context(), m.DB, account, args.Mail.RemoveExtractor.ID)
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// Lists the senders allowed or blocked on a mailbox.
+func (m *App) listSenders(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, args.Mail.Senders.Mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	filters, err := models.ListSenderFilters(session.Context(), m.DB, *mailbox)
+	if err != nil {
+		return 1, err
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, filter := range filters {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", filter.ID, filter.Kind(), filter.Sender)
+	}
+	w.Flush()
+
+	return 0, nil
+}
+
+// Allows or blocks a sender on a mailbox.
+func (m *App) filterSender(
+	session ssh.Session,
+	account accounts.Account,
+	name string,
+	sender string,
+	allow bool,
+) (int, error) {
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, name)
+	if err != nil {
+		return 1, err
+	}
+
+	filter, err := models.CreateSenderFilter(session.Context(), m.DB, *mailbox, sender, allow)
+	if err != nil {
+		return 1, err
+	}
+
+	fmt.Fprintln(session, filter.ID)
+	return 0, nil
+}
+
+func (m *App) removeSender(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	err := models.DeleteSenderFilter(session.Context(), m.DB, account, args.Mail.RemoveSender.ID)
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// Pins or unpins a mail.
+func (m *App) pinMail(
+	session ssh.Session,
+	account accounts.Account,
+	id int64,
+	pinned bool,
+) (int, error) {
+	mail, err := models.GetAccountMail(session.Context(), m.DB, account, id)
+	if err != nil {
+		return 1, err
+	}
+
+	if err := mail.SetImportant(session.Context(), m.DB, pinned); err != nil {
+		return 1, err
+	}
+
+	events.MailboxContentsUpdatedSignal.Emit(account.ID, mail.MailboxID)
+	return 0, nil
+}
+
+// Lists the mailboxes and mails in the trash along with when they will be
+// purged.
+func (m *App) listTrash(session ssh.Session, account accounts.Account) (int, error) {
+	mailboxes, err := models.ListTrashedMailboxes(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, err
+	}
+
+	mails, err := models.ListTrashedMails(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, err
+	}
+
+	// The mails in the trash are only from the mailboxes that are around.
+	active, err := models.ListMailboxes(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, err
+	}
+	emails := make(map[int64]string)
+	for _, mailbox := range active {
+		emails[mailbox.ID] = mailbox.Email()
+	}
+
+	purge := func(deletedAt time.Time) string {
+		remaining := time.Until(deletedAt.Add(config.Mail.TrashRetention))
+		return fmt.Sprintf("purged in %s", utils.RoundedAge(max(remaining, 0)))
+	}
+
+	w := tabwriter.NewWriter(session, 0, 4, 2, ' ', 0)
+	for _, mailbox := range mailboxes {
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\n",
+			mailbox.Email(),
+			purge(mailbox.DeletedAt),
+			mailbox.Label,
+		)
+	}
+	if len(mailboxes) > 0 && len(mails) > 0 {
+		fmt.Fprintln(w)
+	}
+	for _, mail := range mails {
+		fmt.Fprintf(
+			w,
+			"%d\t%s\t%s\t%s\t%s\n",
+			mail.ID,
+			purge(mail.DeletedAt),
+			emails[mail.MailboxID],
+			mail.FromAddress,
+			utils.Decode(mail.DisplaySubject()),
+		)
+	}
+	w.Flush()
+
+	return 0, nil
+}
+
+// Brings back a mail or a mailbox from the trash.
+func (m *App) restoreFromTrash(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	restore := args.Mail.Restore
+
+	if restore.Mailbox != "" {
+		mailbox, err := models.GetTrashedMailbox(session.Context(), m.DB, account, restore.Mailbox)
+		if err != nil {
+			return 1, err
+		}
+		if err := mailbox.Restore(session.Context(), m.DB); err != nil {
+			return 1, err
+		}
+
+		events.MailboxContentsUpdatedSignal.Emit(account.ID, mailbox.ID)
+		return 0, nil
+	}
+
+	if restore.ID == 0 {
+		return 1, fmt.Errorf("either the id of a mail or a --mailbox is required")
+	}
+
+	mail, err := models.GetTrashedMail(session.Context(), m.DB, account, restore.ID)
+	if err != nil {
+		return 1, err
+	}
+	if err := models.RestoreMails(session.Context(), m.DB, []int64{mail.ID}); err != nil {
+		return 1, err
+	}
+
+	events.MailboxContentsUpdatedSignal.Emit(account.ID, mail.MailboxID)
+	return 0, nil
+}
+
+// Shows or updates the retention on the account or a mailbox.
+func (m *App) configureRetention(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	retention := args.Mail.Retention
+
+	settings, err := models.GetSettings(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, err
+	}
+
+	var mailbox *models.Mailbox
+	if retention.Mailbox != "" {
+		mailbox, err = models.GetAccountMailbox(session.Context(), m.DB, account, retention.Mailbox)
+		if err != nil {
+			return 1, err
+		}
+	}
+
+	// Show the current retention if a new value was not passed.
+	if retention.Duration == "" {
+		value := models.Mailbox{}.EffectiveRetention(settings)
+		if mailbox != nil {
+			value = mailbox.EffectiveRetention(settings)
+		}
+
+		fmt.Fprintln(session, value.String())
+		return 0, nil
+	}
+
+	var value time.Duration
+	if retention.Duration != "default" {
+		value, err = time.ParseDuration(retention.Duration)
+		if err != nil {
+			return 1, errors.Wrap(err, "invalid duration")
+		}
+		if value <= 0 {
+			return 1, fmt.Errorf("invalid duration: it needs to be positive")
+		}
+	}
+
+	if mailbox != nil {
+		err = mailbox.SetRetention(session.Context(), m.DB, value)
+	} else {
+		settings.Retention = value
+		err = settings.Save(session.Context(), m.DB)
+	}
+	if err != nil {
+		return 1, err
+	}
+
+	return 0, nil
+}
+
+// Shows or updates how the open sessions on the account announce new mails.
+func (m *App) configureNotifications(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+) (int, error) {
+	options := args.Mail.Notifications
+
+	settings, err := models.GetSettings(session.Context(), m.DB, account)
+	if err != nil {
+		return 1, err
+	}
+
+	// Show the current configuration if nothing was passed.
+	if options.Protocol == "" && options.Bell == nil {
+		protocol, _ := notify.ParseProtocol(settings.Notifications)
+		bell := "no bell"
+		if settings.Bell {
+			bell = "bell"
+		}
+
+		fmt.Fprintf(session, "%s, %s\n", protocol, bell)
+		return 0, nil
+	}
+
+	if options.Protocol != "" {
+		protocol, err := notify.ParseProtocol(options.Protocol)
+		if err != nil {
+			return 1, err
+		}
+
+		settings.Notifications = string(protocol)
+		if protocol == notify.Off {
+			settings.Notifications = ""
+		}
+	}
+	if options.Bell != nil {
+		settings.Bell = *options.Bell
+	}
+
+	if err := settings.Save(session.Context(), m.DB); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// Puts, prints or clears the sieve rules on a mailbox.
+func (m *App) configureRules(
+	session ssh.Session,
+	account accounts.Account,
+	args apps.AppArgs,
+	interactive bool,
+) (int, error) {
+	rules := args.Mail.Rules
+
+	var name string
+	switch {
+	case rules.Put != nil:
+		name = rules.Put.Mailbox
+	case rules.Get != nil:
+		name = rules.Get.Mailbox
+	case rules.Clear != nil:
+		name = rules.Clear.Mailbox
+	default:
+		return 1, fmt.Errorf("use one of put, get or clear")
+	}
+
+	mailbox, err := models.GetAccountMailbox(session.Context(), m.DB, account, name)
+	if err != nil {
+		return 1, err
+	}
+
+	switch {
+	case rules.Get != nil:
+		if mailbox.Rules != "" {
+			fmt.Fprintln(session, strings.TrimRight(mailbox.Rules, "\n"))
+		}
+		return 0, nil
+
+	case rules.Clear != nil:
+		if err := mailbox.SetRules(session.Context(), m.DB, ""); err != nil {
+			return 1, err
+		}
+		return 0, nil
+	}
+
+	if interactive {
+		return 1, fmt.Errorf("pipe a sieve script into the command")
+	}
+
+	r := io.LimitReader(session, maxRulesSize+1)
+	script, err := io.ReadAll(r)
+	if err != nil {
+		return 1, errors.Wrap(err, "could not read rules")
+	}
+	if len(script) > maxRulesSize {
+		return 1, fmt.Errorf("rules exceed the max size limit of %d bytes", maxRulesSize)
+	}
+
+	if err := mailbox.SetRules(session.Context(), m.DB, string(script)); err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
@@ -1,7 +1,30 @@
 package events
 
-import "github.com/ksdme/mail/internal/utils"
+import (
+	"time"
+
+	"github.com/ksdme/mail/internal/utils"
+)
+
+// Describes a mail that was just delivered to a mailbox.
+type MailReceived struct {
+	ID          int64     `json:"id"`
+	MailboxID   int64     `json:"mailbox_id"`
+	ThreadID    int64     `json:"thread_id"`
+	Mailbox     string    `json:"mailbox"`
+	FromAddress string    `json:"from_address"`
+	FromName    string    `json:"from_name,omitempty"`
+	Subject     string    `json:"subject"`
+	Preview     string    `json:"preview"`
+	Code        string    `json:"code,omitempty"`
+	Link        string    `json:"link,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`
+	ReceivedAt  time.Time `json:"received_at"`
+}
 
 var (
 	MailboxContentsUpdatedSignal = utils.NewBroadcastBus[int64, int64]()
+
+	// Carries the full mail unlike the signal above.
+	MailReceivedSignal = utils.NewBroadcastBus[int64, MailReceived]()
 )
@@ -0,0 +1,128 @@
+package extract
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ksdme/mail/internal/config"
+	"github.com/pkg/errors"
+)
+
+// How far away, in characters, a code can be from one of the keywords
+// for it to be considered a one-time code.
+const maxKeywordDistance = 120
+
+var (
+	// Digits, optionally split into groups by a space or a dash, like
+	// 123456, 123 456 or 123-456.
+	codePattern = regexp.MustCompile(`\b\d+(?:[ -]\d+)?\b`)
+
+	// Links are removed before looking for codes because they usually
+	// carry a lot of unrelated digits.
+	anyLinkPattern = regexp.MustCompile(`https?://\S+`)
+)
+
+// Looks for a one-time code in the subject and the text of a mail. The
+// patterns are tried first, in order, and the first capture group, or the
+// whole match otherwise, is used as the code. When none of them match, the
+// configured keyword heuristics are used instead.
+func Code(subject string, text string, patterns []*regexp.Regexp) string {
+	for _, pattern := range patterns {
+		for _, source := range []string{subject, text} {
+			if match := pattern.FindStringSubmatch(source); match != nil {
+				if len(match) > 1 {
+					return strings.TrimSpace(match[1])
+				}
+				return strings.TrimSpace(match[0])
+			}
+		}
+	}
+
+	if code := findCode(subject); code != "" {
+		return code
+	}
+	return findCode(text)
+}
+
+// Returns the code that is closest to one of the keywords.
+func findCode(text string) string {
+	text = anyLinkPattern.ReplaceAllString(text, " ")
+	lowered := strings.ToLower(text)
+
+	var keywords []int
+	for _, keyword := range config.Mail.OTPKeywords {
+		keyword = strings.ToLower(strings.TrimSpace(keyword))
+		if keyword == "" {
+			continue
+		}
+
+		for offset := 0; ; {
+			index := strings.Index(lowered[offset:], keyword)
+			if index < 0 {
+				break
+			}
+			keywords = append(keywords, offset+index)
+			offset += index + len(keyword)
+		}
+	}
+	if len(keywords) == 0 {
+		return ""
+	}
+
+	code := ""
+	closest := maxKeywordDistance + 1
+	for _, bounds := range codePattern.FindAllStringIndex(text, -1) {
+		candidate := text[bounds[0]:bounds[1]]
+
+		digits := strings.NewReplacer(" ", "", "-", "").Replace(candidate)
+		if len(digits) < config.Mail.OTPMinDigits || len(digits) > config.Mail.OTPMaxDigits {
+			continue
+		}
+
+		for _, keyword := range keywords {
+			distance := bounds[0] - keyword
+			if distance < 0 {
+				// Codes preceding the keyword, like "123456 is your code",
+				// are allowed too, but favour the ones that follow it.
+				distance = 2 * (keyword - bounds[1])
+			}
+
+			if distance < closest {
+				closest = distance
+				code = digits
+			}
+		}
+	}
+
+	return code
+}
+
+// Picks the link that looks like a verification or a magic sign in link.
+func VerificationLink(links []string) string {
+	for _, link := range links {
+		lowered := strings.ToLower(link)
+		if strings.Contains(lowered, "unsubscribe") {
+			continue
+		}
+
+		for _, keyword := range config.Mail.LinkKeywords {
+			keyword = strings.ToLower(strings.TrimSpace(keyword))
+			if keyword != "" && strings.Contains(lowered, keyword) {
+				return link
+			}
+		}
+	}
+	return ""
+}
+
+// Compiles a user supplied pattern, making sure it is usable for extraction.
+func CompilePattern(pattern string) (*regexp.Regexp, error) {
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid pattern")
+	}
+	if compiled.NumSubexp() > 1 {
+		return nil, errors.New("pattern can have at most one capture group")
+	}
+	return compiled, nil
+}
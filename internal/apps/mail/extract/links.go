@@ -0,0 +1,52 @@
+package extract
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Matches bare urls in text. Trailing punctuation is trimmed separately.
+	textLinkPattern = regexp.MustCompile(`https?://[^\s<>"'\x60]+`)
+
+	// Matches the targets of anchors in html.
+	hrefPattern = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// Returns all the unique http(s) links in the text and html bodies of a
+// mail, in the order they appear in. Links from the html body come first.
+func Links(text string, body string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	add := func(link string) {
+		link = strings.TrimSpace(link)
+		if !strings.HasPrefix(link, "http://") && !strings.HasPrefix(link, "https://") {
+			return
+		}
+		if !seen[link] {
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+
+	for _, match := range hrefPattern.FindAllStringSubmatch(body, -1) {
+		add(html.UnescapeString(match[1] + match[2] + match[3]))
+	}
+
+	for _, match := range textLinkPattern.FindAllString(text, -1) {
+		add(strings.TrimRight(match, ".,;:!?)]}>"))
+	}
+
+	return links
+}
+
+// Returns the lower cased host name of the link.
+func Host(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
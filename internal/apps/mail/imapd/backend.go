@@ -0,0 +1,152 @@
+// Package imapd exposes the mailboxes on an account over imap. Every mailbox
+// is listed as a folder of its own, and, INBOX carries the mails from all of
+// them. Mails are only read, flagged and deleted, they cannot be appended.
+package imapd
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/utils"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// The folder that carries the mails from all the mailboxes on the account.
+const inbox = "INBOX"
+
+type Backend struct {
+	db *bun.DB
+
+	// Guesses the tokens are limited on each client.
+	throttle *utils.Throttle
+}
+
+func NewBackend(db *bun.DB) *Backend {
+	return &Backend{
+		db:       db,
+		throttle: utils.NewThrottle(5, 15*time.Minute),
+	}
+}
+
+// Logs in using a login token as the password, the username is not used
+// for anything, clients can set it to the token or to a mailbox.
+func (b *Backend) Login(info *imap.ConnInfo, username string, password string) (backend.User, error) {
+	if !b.throttle.Allowed(info.RemoteAddr) {
+		return nil, errors.New("too many failed logins, try again later")
+	}
+
+	account, err := accounts.GetAccountFromToken(context.TODO(), b.db, strings.TrimSpace(password))
+	if err != nil {
+		slog.Error("could not query account", "err", err)
+		return nil, errors.New("could not log in")
+	}
+	if account == nil {
+		b.throttle.Fail(info.RemoteAddr)
+		return nil, backend.ErrInvalidCredentials
+	}
+
+	slog.Debug("imap client logged in", "account", account.ID)
+	return &user{
+		db:       b.db,
+		account:  *account,
+		username: username,
+		burned:   make(map[int64]int64),
+	}, nil
+}
+
+type user struct {
+	db       *bun.DB
+	account  accounts.Account
+	username string
+
+	// The mails read on burn after read mailboxes that were not expunged
+	// along with their mailboxes.
+	burned map[int64]int64
+}
+
+func (u *user) Username() string {
+	return u.username
+}
+
+// Lists INBOX followed by the mailboxes on the account. There are no
+// subscriptions, so, all of them are always listed.
+func (u *user) ListMailboxes(subscribed bool) ([]backend.Mailbox, error) {
+	mailboxes, err := models.ListMailboxes(context.TODO(), u.db, u.account)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := []backend.Mailbox{u.folder(inbox, nil)}
+	for index := range mailboxes {
+		folders = append(folders, u.folder(mailboxes[index].Email(), &mailboxes[index]))
+	}
+	return folders, nil
+}
+
+func (u *user) GetMailbox(name string) (backend.Mailbox, error) {
+	if strings.EqualFold(name, inbox) {
+		return u.folder(inbox, nil), nil
+	}
+
+	mailbox, err := models.GetAccountMailbox(context.TODO(), u.db, u.account, name)
+	if err != nil {
+		slog.Debug("could not find mailbox", "name", name, "err", err)
+		return nil, backend.ErrNoSuchMailbox
+	}
+	return u.folder(mailbox.Email(), mailbox), nil
+}
+
+func (u *user) CreateMailbox(name string) error {
+	return errors.New("mailboxes can only be created over ssh")
+}
+
+func (u *user) DeleteMailbox(name string) error {
+	return errors.New("mailboxes can only be deleted over ssh")
+}
+
+func (u *user) RenameMailbox(existingName, newName string) error {
+	return errors.New("mailboxes cannot be renamed")
+}
+
+// Burns the mails that were read on the session, but, were not expunged.
+func (u *user) Logout() error {
+	if len(u.burned) == 0 {
+		return nil
+	}
+
+	var ids []int64
+	mailboxes := make(map[int64]bool)
+	for id, mailbox := range u.burned {
+		ids = append(ids, id)
+		mailboxes[mailbox] = true
+	}
+	if err := models.BurnMails(context.TODO(), u.db, ids); err != nil {
+		slog.Error("could not burn mails", "account", u.account.ID, "err", err)
+		return err
+	}
+	for mailbox := range mailboxes {
+		events.MailboxContentsUpdatedSignal.Emit(u.account.ID, mailbox)
+	}
+
+	u.burned = make(map[int64]int64)
+	return nil
+}
+
+func (u *user) folder(name string, mailbox *models.Mailbox) *folder {
+	return &folder{
+		db:      u.db,
+		account: u.account,
+		name:    name,
+		mailbox: mailbox,
+		deleted: make(map[int64]bool),
+		burned:  u.burned,
+	}
+}
@@ -0,0 +1,552 @@
+package imapd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/backendutil"
+	"github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+const delimiter = "/"
+
+// A mailbox as an imap folder. The ids of the mails are used as their uids,
+// they only ever go up, so, new mails are always added at the end.
+type folder struct {
+	db      *bun.DB
+	account accounts.Account
+	name    string
+
+	// The mailbox behind the folder, it is nil on INBOX.
+	mailbox *models.Mailbox
+
+	// The mails that were marked as deleted on the session, they are moved
+	// to the trash on expunge.
+	deleted map[int64]bool
+
+	// The mails that were read on burn after read mailboxes along with their
+	// mailboxes, shared across the folders on the session. They are marked as
+	// deleted right away, but, only burned on expunge or logout, so that the
+	// sequence numbers the client knows about do not change from under it.
+	burned map[int64]int64
+
+	// The ids of the mails the client knows about, in the order of their
+	// sequence numbers. Mails can be removed from elsewhere, like the tui or
+	// the cleanup worker, without the client being told, so, the sequence
+	// numbers are resolved against these instead of the mails that are left.
+	known []int64
+}
+
+func (f *folder) Name() string {
+	return f.name
+}
+
+func (f *folder) Info() (*imap.MailboxInfo, error) {
+	return &imap.MailboxInfo{
+		Delimiter:  delimiter,
+		Name:       f.name,
+		Attributes: []string{imap.NoInferiorsAttr},
+	}, nil
+}
+
+func (f *folder) Status(items []imap.StatusItem) (*imap.MailboxStatus, error) {
+	mails, err := f.mails(false)
+	if err != nil {
+		return nil, err
+	}
+
+	// The status is what the client is told when it selects the folder.
+	f.known = ids(mails)
+
+	status := imap.NewMailboxStatus(f.name, items)
+	status.Flags = []string{imap.SeenFlag, imap.FlaggedFlag, imap.DeletedFlag}
+	status.PermanentFlags = []string{imap.SeenFlag, imap.FlaggedFlag, imap.DeletedFlag}
+
+	var unseen uint32
+	for index, mail := range mails {
+		if !mail.Seen {
+			if unseen == 0 {
+				status.UnseenSeqNum = uint32(index + 1)
+			}
+			unseen++
+		}
+	}
+
+	for _, item := range items {
+		switch item {
+		case imap.StatusMessages:
+			status.Messages = uint32(len(mails))
+
+		case imap.StatusRecent:
+			status.Recent = 0
+
+		case imap.StatusUnseen:
+			status.Unseen = unseen
+
+		case imap.StatusUidNext:
+			status.UidNext = 1
+			if len(mails) > 0 {
+				status.UidNext = uint32(mails[len(mails)-1].ID) + 1
+			}
+
+		case imap.StatusUidValidity:
+			// A mailbox that is deleted and created again with the same
+			// name starts over with a different validity.
+			created := f.account.CreatedAt
+			if f.mailbox != nil {
+				created = f.mailbox.CreatedAt
+			}
+			status.UidValidity = uint32(created.Unix())
+		}
+	}
+
+	return status, nil
+}
+
+func (f *folder) SetSubscribed(subscribed bool) error {
+	return nil
+}
+
+func (f *folder) Check() error {
+	return nil
+}
+
+func (f *folder) ListMessages(uid bool, seqSet *imap.SeqSet, items []imap.FetchItem, ch chan<- *imap.Message) error {
+	defer close(ch)
+
+	// Only the flags and the dates can be sent without the contents.
+	full := false
+	for _, item := range items {
+		switch item {
+		case imap.FetchFlags, imap.FetchInternalDate, imap.FetchUid:
+		default:
+			full = true
+		}
+	}
+
+	mails, err := f.mails(full)
+	if err != nil {
+		return err
+	}
+
+	var seen []models.Mail
+	for _, match := range f.matching(mails, uid, seqSet) {
+		mail := match.mail
+		fetched := imap.NewMessage(match.seqNum, items)
+		for _, item := range items {
+			switch item {
+			case imap.FetchEnvelope:
+				header, _, _ := split(f.raw(mail))
+				fetched.Envelope, _ = backendutil.FetchEnvelope(header)
+
+			case imap.FetchBody, imap.FetchBodyStructure:
+				header, body, _ := split(f.raw(mail))
+				fetched.BodyStructure, _ = backendutil.FetchBodyStructure(
+					header,
+					body,
+					item == imap.FetchBodyStructure,
+				)
+
+			case imap.FetchFlags:
+				fetched.Flags = f.flags(mail)
+
+			case imap.FetchInternalDate:
+				fetched.InternalDate = mail.CreatedAt
+
+			case imap.FetchRFC822Size:
+				fetched.Size = uint32(len(f.raw(mail)))
+
+			case imap.FetchUid:
+				fetched.Uid = uint32(mail.ID)
+
+			default:
+				section, err := imap.ParseBodySectionName(item)
+				if err != nil {
+					continue
+				}
+
+				header, body, err := split(f.raw(mail))
+				if err != nil {
+					slog.Debug("could not parse mail", "mail", mail.ID, "err", err)
+					continue
+				}
+
+				literal, _ := backendutil.FetchBodySection(header, body, section)
+				fetched.Body[section] = literal
+
+				// Reading the body marks the mail as seen, unless it was
+				// only peeked at.
+				if !section.Peek && !mail.Seen {
+					seen = append(seen, mail)
+				}
+			}
+		}
+
+		ch <- fetched
+	}
+
+	if len(seen) > 0 {
+		if err := models.SetMailsSeen(context.TODO(), f.db, ids(seen), true); err != nil {
+			return err
+		}
+		if err := f.burn(seen); err != nil {
+			return err
+		}
+		f.updated(seen)
+	}
+
+	return nil
+}
+
+// Marks the mails that are on burn after read mailboxes to be burned.
+func (f *folder) burn(mails []models.Mail) error {
+	mailboxes, err := models.ListMailboxes(context.TODO(), f.db, f.account)
+	if err != nil {
+		return err
+	}
+
+	burning := make(map[int64]bool)
+	for _, mailbox := range mailboxes {
+		burning[mailbox.ID] = mailbox.BurnAfterRead
+	}
+
+	for _, mail := range mails {
+		if burning[mail.MailboxID] {
+			f.burned[mail.ID] = mail.MailboxID
+			f.deleted[mail.ID] = true
+		}
+	}
+	return nil
+}
+
+func (f *folder) SearchMessages(uid bool, criteria *imap.SearchCriteria) ([]uint32, error) {
+	mails, err := f.mails(true)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, numbered := range f.numbered(mails) {
+		mail := numbered.mail
+		entity, err := message.Read(bytes.NewReader(f.raw(mail)))
+		if err != nil && !message.IsUnknownCharset(err) && !message.IsUnknownEncoding(err) {
+			slog.Debug("could not parse mail", "mail", mail.ID, "err", err)
+			continue
+		}
+
+		seqNum := numbered.seqNum
+		matched, err := backendutil.Match(entity, seqNum, uint32(mail.ID), mail.CreatedAt, f.flags(mail), criteria)
+		if err != nil || !matched {
+			continue
+		}
+
+		if uid {
+			ids = append(ids, uint32(mail.ID))
+		} else {
+			ids = append(ids, seqNum)
+		}
+	}
+	return ids, nil
+}
+
+func (f *folder) CreateMessage(flags []string, date time.Time, body imap.Literal) error {
+	return errors.New("mails cannot be appended to mailboxes")
+}
+
+// Maps \Seen and \Flagged on to the seen and important mails, \Deleted is
+// only kept around on the session until the folder is expunged.
+func (f *folder) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, op imap.FlagsOp, flags []string) error {
+	mails, err := f.mails(false)
+	if err != nil {
+		return err
+	}
+
+	var changed []models.Mail
+	var seen, unseen, important, unimportant []int64
+	for _, match := range f.matching(mails, uid, seqSet) {
+		mail := match.mail
+		updated := backendutil.UpdateFlags(f.flags(mail), op, flags)
+
+		if flagged := hasFlag(updated, imap.SeenFlag); flagged != mail.Seen {
+			if flagged {
+				seen = append(seen, mail.ID)
+			} else {
+				unseen = append(unseen, mail.ID)
+			}
+			changed = append(changed, mail)
+		}
+
+		if flagged := hasFlag(updated, imap.FlaggedFlag); flagged != mail.Important {
+			if flagged {
+				important = append(important, mail.ID)
+			} else {
+				unimportant = append(unimportant, mail.ID)
+			}
+			changed = append(changed, mail)
+		}
+
+		if hasFlag(updated, imap.DeletedFlag) {
+			f.deleted[mail.ID] = true
+		} else {
+			delete(f.deleted, mail.ID)
+		}
+	}
+
+	ctx := context.TODO()
+	if len(seen) > 0 {
+		if err := models.SetMailsSeen(ctx, f.db, seen, true); err != nil {
+			return err
+		}
+	}
+	if len(unseen) > 0 {
+		if err := models.SetMailsSeen(ctx, f.db, unseen, false); err != nil {
+			return err
+		}
+	}
+	if len(important) > 0 {
+		if err := models.SetMailsImportant(ctx, f.db, important, true); err != nil {
+			return err
+		}
+	}
+	if len(unimportant) > 0 {
+		if err := models.SetMailsImportant(ctx, f.db, unimportant, false); err != nil {
+			return err
+		}
+	}
+
+	f.updated(changed)
+	return nil
+}
+
+func (f *folder) CopyMessages(uid bool, seqSet *imap.SeqSet, dest string) error {
+	return errors.New("mails cannot be copied between mailboxes")
+}
+
+// Moves the mails that were marked as deleted to the trash.
+func (f *folder) Expunge() error {
+	if len(f.deleted) == 0 {
+		return nil
+	}
+
+	mails, err := f.mails(false)
+	if err != nil {
+		return err
+	}
+
+	var deleted, burned []models.Mail
+	for _, mail := range mails {
+		if _, ok := f.burned[mail.ID]; ok && f.deleted[mail.ID] {
+			burned = append(burned, mail)
+		} else if f.deleted[mail.ID] {
+			deleted = append(deleted, mail)
+		}
+	}
+
+	if len(deleted) > 0 {
+		if err := models.DeleteMails(context.TODO(), f.db, ids(deleted)); err != nil {
+			return err
+		}
+		f.updated(deleted)
+	}
+	if len(burned) > 0 {
+		if err := models.BurnMails(context.TODO(), f.db, ids(burned)); err != nil {
+			return err
+		}
+		for _, mail := range burned {
+			delete(f.burned, mail.ID)
+		}
+		f.updated(burned)
+	}
+
+	// The client drops the expunged mails and renumbers the rest too.
+	expunged := make(map[int64]bool)
+	for _, mail := range append(deleted, burned...) {
+		expunged[mail.ID] = true
+	}
+	var known []int64
+	for _, id := range f.known {
+		if !expunged[id] {
+			known = append(known, id)
+		}
+	}
+	f.known = known
+
+	f.deleted = make(map[int64]bool)
+	return nil
+}
+
+// Lists the mails on the folder, oldest first. Unless full is set, only the
+// columns needed for the flags are queried.
+func (f *folder) mails(full bool) ([]models.Mail, error) {
+	var mails []models.Mail
+
+	query := f.db.NewSelect().Model(&mails).Order("id ASC")
+	if !full {
+		query = query.Column("id", "seen", "important", "tags", "mailbox_id", "created_at")
+	}
+	if f.mailbox != nil {
+		query = query.Where("mailbox_id = ?", f.mailbox.ID)
+	} else {
+		query = query.Where(
+			"mailbox_id IN (?)",
+			f.db.NewSelect().
+				Model((*models.Mailbox)(nil)).
+				Column("id").
+				Where("account_id = ?", f.account.ID),
+		)
+	}
+
+	if err := query.Scan(context.TODO()); err != nil {
+		return nil, errors.Wrap(err, "could not query mails")
+	}
+	return mails, nil
+}
+
+type match struct {
+	seqNum uint32
+	mail   models.Mail
+}
+
+// Returns the mails along with the sequence numbers the client knows them
+// by. The mails that were removed from elsewhere keep their numbers to
+// themselves, and, the new ones are numbered after the known ones.
+func (f *folder) numbered(mails []models.Mail) []match {
+	byID := make(map[int64]models.Mail, len(mails))
+	for _, mail := range mails {
+		byID[mail.ID] = mail
+	}
+
+	// The ids only go up, so, the new mails are the ones after the last.
+	var last int64
+	if len(f.known) > 0 {
+		last = f.known[len(f.known)-1]
+	}
+	for _, mail := range mails {
+		if mail.ID > last {
+			f.known = append(f.known, mail.ID)
+		}
+	}
+
+	var numbered []match
+	for index, id := range f.known {
+		if mail, ok := byID[id]; ok {
+			numbered = append(numbered, match{seqNum: uint32(index + 1), mail: mail})
+		}
+	}
+	return numbered
+}
+
+// Returns the mails in the sequence set along with their sequence numbers.
+func (f *folder) matching(mails []models.Mail, uid bool, seqSet *imap.SeqSet) []match {
+	numbered := f.numbered(mails)
+
+	var last uint32
+	if len(f.known) > 0 {
+		last = uint32(len(f.known))
+		if uid {
+			last = uint32(f.known[len(f.known)-1])
+		}
+	}
+
+	var matched []match
+	for _, match := range numbered {
+		id := match.seqNum
+		if uid {
+			id = uint32(match.mail.ID)
+		}
+		if contains(seqSet, id, last) {
+			matched = append(matched, match)
+		}
+	}
+	return matched
+}
+
+func (f *folder) flags(mail models.Mail) []string {
+	var flags []string
+	if mail.Seen {
+		flags = append(flags, imap.SeenFlag)
+	}
+	if mail.Important {
+		flags = append(flags, imap.FlaggedFlag)
+	}
+	if f.deleted[mail.ID] {
+		flags = append(flags, imap.DeletedFlag)
+	}
+
+	// The tags set by the rules are shown as keywords.
+	return append(flags, strings.Fields(mail.Tags)...)
+}
+
+// Mails on INBOX need their mailbox to be put back together when they were
+// received before the messages were kept around.
+func (f *folder) raw(mail models.Mail) []byte {
+	if mail.Mailbox == nil {
+		mail.Mailbox = f.mailbox
+	}
+	return mail.Message()
+}
+
+// Lets the open sessions know about the mailboxes of the changed mails.
+func (f *folder) updated(mails []models.Mail) {
+	mailboxes := make(map[int64]bool)
+	for _, mail := range mails {
+		mailboxes[mail.MailboxID] = true
+	}
+	for mailbox := range mailboxes {
+		events.MailboxContentsUpdatedSignal.Emit(f.account.ID, mailbox)
+	}
+}
+
+func ids(mails []models.Mail) []int64 {
+	ids := make([]int64, len(mails))
+	for index, mail := range mails {
+		ids[index] = mail.ID
+	}
+	return ids
+}
+
+func split(raw []byte) (textproto.Header, *bufio.Reader, error) {
+	body := bufio.NewReader(bytes.NewReader(raw))
+	header, err := textproto.ReadHeader(body)
+	return header, body, err
+}
+
+// Unlike the SeqSet.Contains, it resolves * to the last message.
+func contains(seqSet *imap.SeqSet, id uint32, last uint32) bool {
+	for _, seq := range seqSet.Set {
+		start, stop := seq.Start, seq.Stop
+		if start == 0 {
+			start = last
+		}
+		if stop == 0 {
+			stop = last
+		}
+		if start > stop {
+			start, stop = stop, start
+		}
+		if start <= id && id <= stop {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, value := range flags {
+		if value == flag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package lint
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ksdme/mail/internal/apps/mail/backend"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+)
+
+// Gmail clips messages whose html is larger than this.
+const ClippingSize = 102 * 1024
+
+type Severity string
+
+const (
+	Error   Severity = "error"
+	Warning Severity = "warning"
+)
+
+// A problem found on the html of a mail.
+type Issue struct {
+	Severity Severity
+	Rule     string
+	Message  string
+}
+
+type Report struct {
+	// Size of the whole message and the html part, in bytes.
+	Size     int
+	HTMLSize int
+
+	Issues []Issue
+}
+
+// Returns a boolean indicating if there are any errors on the report.
+func (r Report) Failed() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// CSS properties, at-rules and values that are not supported, or, are only
+// partially supported across the popular mail clients.
+var unsupportedCSS = []struct {
+	pattern *regexp.Regexp
+	name    string
+}{
+	{regexp.MustCompile(`(?i)(^|[;{\s])position\s*:`), "position"},
+	{regexp.MustCompile(`(?i)display\s*:\s*(inline-)?flex`), "display: flex"},
+	{regexp.MustCompile(`(?i)display\s*:\s*(inline-)?grid`), "display: grid"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])float\s*:`), "float"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])box-shadow\s*:`), "box-shadow"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])transform\s*:`), "transform"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])animation(-name)?\s*:`), "animation"},
+	{regexp.MustCompile(`(?i)(^|[;{\s])transition\s*:`), "transition"},
+	{regexp.MustCompile(`(?i)var\(\s*--`), "css variables"},
+	{regexp.MustCompile(`(?i)calc\(`), "calc()"},
+	{regexp.MustCompile(`(?i)@import`), "@import"},
+	{regexp.MustCompile(`(?i)@font-face`), "@font-face"},
+}
+
+// Lints the html part of a message. Links are only checked statically, they
+// are never fetched.
+func Lint(raw []byte, message *backend.Message) Report {
+	report := Report{
+		Size:     len(raw),
+		HTMLSize: len(message.HTML),
+	}
+	if message.HTML == "" {
+		return report
+	}
+
+	add := func(severity Severity, rule string, format string, args ...any) {
+		report.Issues = append(report.Issues, Issue{
+			Severity: severity,
+			Rule:     rule,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if report.HTMLSize > ClippingSize {
+		add(
+			Error,
+			"size",
+			"html is %s, gmail clips anything above %s",
+			FormatSize(report.HTMLSize),
+			FormatSize(ClippingSize),
+		)
+	}
+
+	if strings.TrimSpace(message.Text) == "" {
+		add(Warning, "text-alternative", "there is no plain text alternative to the html part")
+	}
+
+	document, err := html.Parse(strings.NewReader(message.HTML))
+	if err != nil {
+		add(Error, "html", "could not parse html: %v", err)
+		return report
+	}
+
+	var css []string
+	walk(document, func(node *html.Node) {
+		if node.Type != html.ElementNode {
+			return
+		}
+
+		if style, ok := attribute(node, "style"); ok {
+			css = append(css, style)
+		}
+
+		switch node.Data {
+		case "a":
+			href, ok := attribute(node, "href")
+			if !ok {
+				return
+			}
+			if problem, severity := checkLink(href); problem != "" {
+				add(severity, "link", "%s: %s", problem, describeLink(href))
+			}
+
+		case "img":
+			src, _ := attribute(node, "src")
+			if isTrackingPixel(node) {
+				add(Warning, "tracking-pixel", "tracking pixel: %s", describeLink(src))
+				return
+			}
+
+			if _, ok := attribute(node, "alt"); !ok {
+				add(Warning, "alt", "image without alt text: %s", describeLink(src))
+			}
+			if strings.HasPrefix(strings.ToLower(src), "http://") {
+				add(Warning, "image", "insecure image: %s", describeLink(src))
+			}
+
+		case "style":
+			if node.FirstChild != nil {
+				css = append(css, node.FirstChild.Data)
+			}
+
+		case "link":
+			if rel, _ := attribute(node, "rel"); strings.EqualFold(rel, "stylesheet") {
+				href, _ := attribute(node, "href")
+				add(Warning, "css", "external stylesheets are stripped by most clients: %s", describeLink(href))
+			}
+
+		case "script", "form", "iframe", "video", "object", "embed":
+			add(Warning, "element", "<%s> is not supported by most clients", node.Data)
+		}
+	})
+
+	counts := make(map[string]int)
+	for _, block := range css {
+		for _, property := range unsupportedCSS {
+			counts[property.name] += len(property.pattern.FindAllStringIndex(block, -1))
+		}
+	}
+	var names []string
+	for name, count := range counts {
+		if count > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if counts[name] > 1 {
+			add(Warning, "css", "%s is not supported by some clients, used %d times", name, counts[name])
+		} else {
+			add(Warning, "css", "%s is not supported by some clients", name)
+		}
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		return report.Issues[i].Severity == Error && report.Issues[j].Severity != Error
+	})
+	return report
+}
+
+// Lints the html part of a received mail.
+func LintMail(mail models.Mail) (*Report, error) {
+	if len(mail.Raw) == 0 {
+		return nil, errors.New("the original message was not kept around for this mail")
+	}
+
+	message, err := backend.ParseMessage(mail.Raw)
+	if err != nil {
+		return nil, err
+	}
+
+	report := Lint(mail.Raw, message)
+	return &report, nil
+}
+
+// Returns the problem with a link, if any.
+func checkLink(href string) (string, Severity) {
+	href = strings.TrimSpace(href)
+	lowered := strings.ToLower(href)
+
+	switch {
+	case href == "" || href == "#":
+		return "empty link", Error
+
+	case strings.HasPrefix(lowered, "javascript:"):
+		return "javascript link", Error
+
+	case strings.HasPrefix(lowered, "mailto:"), strings.HasPrefix(lowered, "tel:"):
+		return "", ""
+
+	// Templating engines leave these around when a variable is missing.
+	case strings.Contains(href, "{{") || strings.Contains(href, "}}") ||
+		strings.Contains(href, "%7B%7B") || strings.Contains(href, "*|"):
+		return "unrendered template variable in link", Error
+	}
+
+	parsed, err := url.Parse(href)
+	if err != nil {
+		return "malformed link", Error
+	}
+
+	switch {
+	case parsed.Scheme == "":
+		return "relative link", Error
+
+	case parsed.Scheme != "http" && parsed.Scheme != "https":
+		return "", ""
+
+	case parsed.Hostname() == "":
+		return "link without a host", Error
+
+	case isLocalHost(parsed.Hostname()):
+		return "link to a local host", Error
+
+	case parsed.Scheme == "http":
+		return "insecure link", Warning
+	}
+
+	return "", ""
+}
+
+func isLocalHost(host string) bool {
+	host = strings.ToLower(host)
+	return host == "localhost" ||
+		strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".local") ||
+		strings.HasPrefix(host, "127.") ||
+		host == "0.0.0.0" ||
+		host == "::1"
+}
+
+// Images that are at most a pixel wide, or, are hidden are considered as
+// tracking pixels.
+func isTrackingPixel(node *html.Node) bool {
+	width, _ := attribute(node, "width")
+	height, _ := attribute(node, "height")
+	if isTiny(width) && isTiny(height) {
+		return true
+	}
+
+	style, _ := attribute(node, "style")
+	style = strings.ReplaceAll(strings.ToLower(style), " ", "")
+	if strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+		return true
+	}
+	return strings.Contains(style, "width:1px") && strings.Contains(style, "height:1px") ||
+		strings.Contains(style, "width:0") && strings.Contains(style, "height:0")
+}
+
+func isTiny(dimension string) bool {
+	value, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(dimension), "px"))
+	return err == nil && value <= 1
+}
+
+func attribute(node *html.Node, name string) (string, bool) {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+func walk(node *html.Node, visit func(*html.Node)) {
+	visit(node)
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, visit)
+	}
+}
+
+// Links can get really long, truncate them.
+func describeLink(link string) string {
+	if link == "" {
+		return "(empty)"
+	}
+	if runes := []rune(link); len(runes) > 80 {
+		return string(runes[:80]) + "…"
+	}
+	return link
+}
+
+// Formats the size in bytes as kilobytes.
+func FormatSize(size int) string {
+	return fmt.Sprintf("%.1fKB", float64(size)/1024)
+}
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/config"
+	"github.com/ksdme/mail/internal/utils"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// The prefix on the TXT record that proves the ownership of a domain.
+const verificationPrefix = "mail-verification="
+
+// The top level domain is either made of letters, or, is an internationalized
+// one in its punycode form, like xn--p1ai.
+var domainPattern = regexp.MustCompile(`^([a-z\d]([a-z\d\-]*[a-z\d])?\.)+([a-z]{2,}|xn--[a-z\d\-]*[a-z\d])$`)
+
+// The lookups needed to verify a domain, it is satisfied by net.Resolver.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+}
+
+// A domain brought in by an account. Once it is verified, mails to any
+// address on it are accepted, the ones without a mailbox of their own land
+// on the catch-all mailbox.
+type Domain struct {
+	ID   int64  `bun:",pk,autoincrement"`
+	Name string `bun:",notnull,unique:domain_account"`
+
+	// The value of the TXT record that needs to be on the domain.
+	Token      string    `bun:",notnull"`
+	VerifiedAt time.Time `bun:",nullzero"`
+
+	// Created when the domain is verified.
+	MailboxID int64 `bun:",nullzero"`
+
+	AccountID int64             `bun:",notnull,unique:domain_account"`
+	Account   *accounts.Account `bun:"rel:belongs-to,join:account_id=id,on_delete:cascade"`
+
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// Returns a boolean indicating if the ownership of the domain was verified.
+func (d Domain) Verified() bool {
+	return !d.VerifiedAt.IsZero()
+}
+
+// Returns the TXT record that needs to be on the domain.
+func (d Domain) Record() string {
+	return verificationPrefix + d.Token
+}
+
+// Creates the index that keeps a domain from being verified by more than one
+// account, even if they verify it at the same time.
+func CreateDomainIndex(ctx context.Context, db *bun.DB) error {
+	_, err := db.ExecContext(
+		ctx,
+		`CREATE UNIQUE INDEX IF NOT EXISTS domains_verified_name
+		ON domains (name) WHERE verified_at IS NOT NULL`,
+	)
+	if err != nil {
+		return errors.Wrap(err, "could not create domain index")
+	}
+	return nil
+}
+
+// Adds a domain to the account, it only accepts mails once it is verified.
+// Several accounts can claim a domain, but, only one of them can verify it.
+func CreateDomain(ctx context.Context, db *bun.DB, account accounts.Account, name string) (*Domain, error) {
+	name = normalizeDomain(name)
+	if !domainPattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid domain: %s", name)
+	}
+	if config.Mail.HasDomain(name) {
+		return nil, fmt.Errorf("%s is already served by this server", name)
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "could not generate verification token")
+	}
+
+	domain := &Domain{
+		Name:      name,
+		Token:     hex.EncodeToString(nonce),
+		AccountID: account.ID,
+	}
+	if _, err := db.NewInsert().Model(domain).Exec(ctx); err != nil {
+		if utils.IsUniqueConstraintErr(err) {
+			return nil, fmt.Errorf("%s was already added to your account", name)
+		}
+		return nil, errors.Wrap(err, "could not add domain")
+	}
+	return domain, nil
+}
+
+func ListDomains(ctx context.Context, db *bun.DB, account accounts.Account) ([]Domain, error) {
+	var domains []Domain
+	err := db.
+		NewSelect().
+		Model(&domains).
+		Where("account_id = ?", account.ID).
+		Order("name ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query domains")
+	}
+	return domains, nil
+}
+
+// Returns the domains mailboxes on the account can be put on. The ones
+// served by the server come first, starting with the mx host.
+func ListMailboxDomains(ctx context.Context, db *bun.DB, account accounts.Account) ([]string, error) {
+	names := config.Mail.Domains()
+
+	domains, err := ListDomains(ctx, db, account)
+	if err != nil {
+		return nil, err
+	}
+	for _, domain := range domains {
+		if domain.Verified() {
+			names = append(names, domain.Name)
+		}
+	}
+	return names, nil
+}
+
+func GetAccountDomain(ctx context.Context, db *bun.DB, account accounts.Account, name string) (*Domain, error) {
+	domain := &Domain{}
+	err := db.
+		NewSelect().
+		Model(domain).
+		Where("account_id = ?", account.ID).
+		Where("name = ?", normalizeDomain(name)).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown domain: %s", name)
+		}
+		return nil, errors.Wrap(err, "could not query domains")
+	}
+	return domain, nil
+}
+
+// Returns the verified domain with the name, or, nil if there isn't one.
+func GetVerifiedDomain(ctx context.Context, db bun.IDB, name string) (*Domain, error) {
+	domain := &Domain{}
+	err := db.
+		NewSelect().
+		Model(domain).
+		Where("name = ?", normalizeDomain(name)).
+		Where("verified_at IS NOT NULL").
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "could not query domains")
+	}
+	return domain, nil
+}
+
+// Checks the TXT and MX records on the domain and marks it as verified, a
+// catch-all mailbox is created on it the first time around.
+func (d *Domain) Verify(ctx context.Context, db *bun.DB, resolver Resolver) error {
+	if other, err := GetVerifiedDomain(ctx, db, d.Name); err != nil {
+		return err
+	} else if other != nil && other.ID != d.ID {
+		return fmt.Errorf("%s was verified by another account", d.Name)
+	}
+
+	records, err := resolver.LookupTXT(ctx, d.Name)
+	if err != nil {
+		return errors.Wrap(err, "could not look up TXT records")
+	}
+	found := false
+	for _, record := range records {
+		found = found || strings.TrimSpace(record) == d.Record()
+	}
+	if !found {
+		return fmt.Errorf("could not find a TXT record with %s on %s", d.Record(), d.Name)
+	}
+
+	exchanges, err := resolver.LookupMX(ctx, d.Name)
+	if err != nil {
+		return errors.Wrap(err, "could not look up MX records")
+	}
+	found = false
+	for _, exchange := range exchanges {
+		found = found || normalizeDomain(exchange.Host) == normalizeDomain(config.Mail.MXHost)
+	}
+	if !found {
+		return fmt.Errorf("could not find an MX record pointing to %s on %s", config.Mail.MXHost, d.Name)
+	}
+
+	// The domain is checked again, since another account could have verified
+	// it in the meantime, and, the catch-all mailbox goes along with it.
+	verified := *d
+	err = db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if other, err := GetVerifiedDomain(ctx, tx, d.Name); err != nil {
+			return err
+		} else if other != nil && other.ID != d.ID {
+			return fmt.Errorf("%s was verified by another account", d.Name)
+		}
+
+		verified.VerifiedAt = time.Now()
+		_, err := tx.NewUpdate().Model(&verified).Column("verified_at").WherePK().Exec(ctx)
+		if err != nil {
+			if utils.IsUniqueConstraintErr(err) {
+				return fmt.Errorf("%s was verified by another account", d.Name)
+			}
+			return errors.Wrap(err, "could not update domain")
+		}
+
+		// Mailboxes can only be put on the domain once it is verified.
+		if verified.MailboxID == 0 {
+			name, err := generateMailboxName(ctx, tx, sitePrefix(d.Name))
+			if err != nil {
+				return err
+			}
+			mailbox, err := createMailbox(ctx, tx, accounts.Account{ID: d.AccountID}, name, d.Name)
+			if err != nil {
+				return err
+			}
+			label := "*@" + d.Name
+			if err := mailbox.Describe(ctx, tx, &label, nil); err != nil {
+				return err
+			}
+
+			verified.MailboxID = mailbox.ID
+			_, err = tx.NewUpdate().Model(&verified).Column("mailbox_id").WherePK().Exec(ctx)
+			if err != nil {
+				return errors.Wrap(err, "could not update domain")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	*d = verified
+	return nil
+}
+
+// Returns the mailbox mails to the address on the domain are delivered to,
+// it is the catch-all mailbox unless the address has a mailbox of its own.
+func (d Domain) Route(ctx context.Context, db *bun.DB, name string) (*Mailbox, error) {
+	mailbox := &Mailbox{}
+	err := db.
+		NewSelect().
+		Model(mailbox).
+		Where("account_id = ?", d.AccountID).
+		Where("domain = ?", d.Name).
+		Where("name = ?", normalizeMailbox(name)).
+		Scan(ctx)
+	if err == nil {
+		return mailbox, nil
+	} else if err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "could not query mailboxes")
+	}
+
+	err = db.
+		NewSelect().
+		Model(mailbox).
+		Where("id = ?", d.MailboxID).
+		Where("account_id = ?", d.AccountID).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("the catch-all mailbox on %s was deleted", d.Name)
+		}
+		return nil, errors.Wrap(err, "could not query mailboxes")
+	}
+	return mailbox, nil
+}
+
+// Removes the domain from the account, the mailboxes on it are left alone,
+// but, they stop receiving mails.
+func (d Domain) Delete(ctx context.Context, db *bun.DB) error {
+	if _, err := db.NewDelete().Model(&d).WherePK().Exec(ctx); err != nil {
+		return errors.Wrap(err, "could not delete domain")
+	}
+	return nil
+}
+
+// Returns a boolean indicating if mailboxes on the account can be put on the
+// domain, which is either served by the server or verified by the account.
+func domainAllowed(ctx context.Context, db bun.IDB, account accounts.Account, name string) (bool, error) {
+	if config.Mail.HasDomain(name) {
+		return true, nil
+	}
+
+	domain, err := GetVerifiedDomain(ctx, db, name)
+	if err != nil {
+		return false, err
+	}
+	return domain != nil && domain.AccountID == account.ID, nil
+}
+
+func normalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
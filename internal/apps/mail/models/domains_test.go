@@ -0,0 +1,234 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"strings"
+	"testing"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/config"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/sqlitedialect"
+)
+
+// Answers the lookups with fixed records.
+type fakeResolver struct {
+	txt map[string][]string
+	mx  map[string][]string
+}
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return r.txt[name], nil
+}
+
+func (r fakeResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	var exchanges []*net.MX
+	for _, host := range r.mx[name] {
+		exchanges = append(exchanges, &net.MX{Host: host, Pref: 10})
+	}
+	return exchanges, nil
+}
+
+func newTestDB(t *testing.T) *bun.DB {
+	t.Helper()
+
+	sqldb, err := sql.Open("sqlite3", "file::memory:")
+	if err != nil {
+		t.Fatalf("could not open db: %v", err)
+	}
+	// Every connection would get a database of its own otherwise.
+	sqldb.SetMaxOpenConns(1)
+
+	db := bun.NewDB(sqldb, sqlitedialect.New())
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	for _, model := range []interface{}{
+		(*accounts.Account)(nil),
+		(*Mailbox)(nil),
+		(*Domain)(nil),
+	} {
+		if _, err := db.NewCreateTable().Model(model).Exec(ctx); err != nil {
+			t.Fatalf("could not create table: %v", err)
+		}
+	}
+	if err := CreateDomainIndex(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func newTestAccount(t *testing.T, db *bun.DB) accounts.Account {
+	t.Helper()
+
+	account := accounts.Account{}
+	if _, err := db.NewInsert().Model(&account).Exec(context.Background()); err != nil {
+		t.Fatalf("could not create account: %v", err)
+	}
+	return account
+}
+
+func TestVerifyDomain(t *testing.T) {
+	mx := config.Mail.MXHost + "."
+
+	tests := []struct {
+		name string
+
+		// Whether another account verified the domain first.
+		claimed bool
+		txt     []string
+		mx      []string
+
+		err string
+	}{
+		{
+			name: "verified",
+			txt:  []string{"v=spf1 -all", "{record}"},
+			mx:   []string{"mx.example.org.", mx},
+		},
+		{
+			name: "missing txt record",
+			txt:  []string{"v=spf1 -all", verificationPrefix + "other"},
+			mx:   []string{mx},
+			err:  "could not find a TXT record",
+		},
+		{
+			name: "missing mx record",
+			txt:  []string{"{record}"},
+			mx:   []string{"mx.example.org."},
+			err:  "could not find an MX record",
+		},
+		{
+			name:    "claimed by another account",
+			claimed: true,
+			txt:     []string{"{record}", "{other}"},
+			mx:      []string{mx},
+			err:     "was verified by another account",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			db := newTestDB(t)
+
+			domain, err := CreateDomain(ctx, db, newTestAccount(t, db), "Example.com.")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var txt []string
+			for _, record := range test.txt {
+				txt = append(txt, strings.ReplaceAll(record, "{record}", domain.Record()))
+			}
+
+			if test.claimed {
+				other, err := CreateDomain(ctx, db, newTestAccount(t, db), "example.com")
+				if err != nil {
+					t.Fatal(err)
+				}
+				resolver := fakeResolver{
+					txt: map[string][]string{"example.com": {other.Record()}},
+					mx:  map[string][]string{"example.com": {mx}},
+				}
+				if err := other.Verify(ctx, db, resolver); err != nil {
+					t.Fatalf("could not verify the other domain: %v", err)
+				}
+				for index := range txt {
+					txt[index] = strings.ReplaceAll(txt[index], "{other}", other.Record())
+				}
+			}
+
+			resolver := fakeResolver{
+				txt: map[string][]string{"example.com": txt},
+				mx:  map[string][]string{"example.com": test.mx},
+			}
+			err = domain.Verify(ctx, db, resolver)
+
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error with %q, got %v", test.err, err)
+				}
+				if domain.Verified() || domain.MailboxID != 0 {
+					t.Fatalf("expected the domain to be left alone, got %+v", domain)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("could not verify domain: %v", err)
+			}
+			if !domain.Verified() {
+				t.Fatalf("expected the domain to be verified")
+			}
+
+			mailbox := &Mailbox{}
+			if err := db.NewSelect().Model(mailbox).Where("id = ?", domain.MailboxID).Scan(ctx); err != nil {
+				t.Fatalf("could not find the catch-all mailbox: %v", err)
+			}
+			if mailbox.Domain != "example.com" || mailbox.Label != "*@example.com" {
+				t.Fatalf("unexpected catch-all mailbox %+v", mailbox)
+			}
+		})
+	}
+}
+
+func TestRouteDomain(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	account := newTestAccount(t, db)
+
+	domain, err := CreateDomain(ctx, db, account, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver := fakeResolver{
+		txt: map[string][]string{"example.com": {domain.Record()}},
+		mx:  map[string][]string{"example.com": {config.Mail.MXHost}},
+	}
+	if err := domain.Verify(ctx, db, resolver); err != nil {
+		t.Fatal(err)
+	}
+
+	own, err := createMailbox(ctx, db, account, "billing", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same name on the mx host does not belong to the domain.
+	if _, err := createMailbox(ctx, db, account, "support", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		address string
+		mailbox int64
+	}{
+		{address: "billing", mailbox: own.ID},
+		{address: "Billing", mailbox: own.ID},
+		{address: "support", mailbox: domain.MailboxID},
+		{address: "anything.else", mailbox: domain.MailboxID},
+	}
+
+	for _, test := range tests {
+		t.Run(test.address, func(t *testing.T) {
+			mailbox, err := domain.Route(ctx, db, test.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mailbox.ID != test.mailbox {
+				t.Fatalf("expected mailbox %d, got %d", test.mailbox, mailbox.ID)
+			}
+		})
+	}
+
+	// Mails are refused once the catch-all mailbox is gone.
+	if _, err := db.NewDelete().Model((*Mailbox)(nil)).Where("id = ?", domain.MailboxID).ForceDelete().Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := domain.Route(ctx, db, "anything.else"); err == nil {
+		t.Fatalf("expected the route to fail without the catch-all mailbox")
+	}
+}
@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/extract"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// A pattern used to pull out one-time codes from mails sent by a sender,
+// for when the default heuristics don't work out.
+type Extractor struct {
+	ID int64 `bun:",pk,autoincrement"`
+
+	// Either the address or the domain of the sender.
+	Sender  string `bun:",notnull"`
+	Pattern string `bun:",notnull"`
+
+	AccountID int64             `bun:",notnull"`
+	Account   *accounts.Account `bun:"rel:belongs-to,join:account_id=id,on_delete:cascade"`
+
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// Returns a boolean indicating if the extractor applies to the sender.
+func (e Extractor) Matches(address string) bool {
+	return MatchesSender(e.Sender, address)
+}
+
+// Returns a boolean indicating if the address is the sender, or, if the
+// sender is a domain, whether the address is on it or on a subdomain of it.
+func MatchesSender(sender string, address string) bool {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	address = strings.ToLower(address)
+	if strings.Contains(sender, "@") {
+		return sender == address
+	}
+	return strings.HasSuffix(address, "@"+sender) || strings.HasSuffix(address, "."+sender)
+}
+
+func CreateExtractor(
+	ctx context.Context,
+	db *bun.DB,
+	account accounts.Account,
+	sender string,
+	pattern string,
+) (*Extractor, error) {
+	sender = strings.ToLower(strings.TrimSpace(sender))
+	if sender == "" {
+		return nil, errors.New("sender cannot be empty")
+	}
+
+	if _, err := extract.CompilePattern(pattern); err != nil {
+		return nil, err
+	}
+
+	extractor := &Extractor{
+		Sender:    sender,
+		Pattern:   pattern,
+		AccountID: account.ID,
+	}
+	if _, err := db.NewInsert().Model(extractor).Exec(ctx); err != nil {
+		return nil, errors.Wrap(err, "could not create extractor")
+	}
+	return extractor, nil
+}
+
+func ListExtractors(ctx context.Context, db *bun.DB, accountID int64) ([]Extractor, error) {
+	var extractors []Extractor
+	err := db.
+		NewSelect().
+		Model(&extractors).
+		Where("account_id = ?", accountID).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query extractors")
+	}
+	return extractors, nil
+}
+
+func DeleteExtractor(ctx context.Context, db *bun.DB, account accounts.Account, id int64) error {
+	result, err := db.
+		NewDelete().
+		Model((*Extractor)(nil)).
+		Where("id = ?", id).
+		Where("account_id = ?", account.ID).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not delete extractor")
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return errors.New("extractor not found")
+	}
+	return nil
+}
+
+// Returns the compiled patterns of the extractors on the account that
+// apply to the sender.
+func SenderPatterns(ctx context.Context, db *bun.DB, accountID int64, sender string) ([]*regexp.Regexp, error) {
+	extractors, err := ListExtractors(ctx, db, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []*regexp.Regexp
+	for _, extractor := range extractors {
+		if !extractor.Matches(sender) {
+			continue
+		}
+
+		// Patterns are validated when they are created, so, this should
+		// never really fail.
+		if pattern, err := extract.CompilePattern(extractor.Pattern); err == nil {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns, nil
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// A mail that arrived on a mailbox from a sender that is unrelated to
+// the site the mailbox was given out to. This usually means that the
+// address was sold or leaked.
+type Leak struct {
+	Mailbox Mailbox
+	Mail    Mail
+
+	// The site the mailbox was given out to and the domain of the sender.
+	Site   string
+	Sender string
+}
+
+// Finds all the mails on the account that look like they were sent to an
+// address that was leaked. Only mailboxes with a site, or a label that looks
+// like a domain, are considered.
+func FindLeaks(ctx context.Context, db *bun.DB, account accounts.Account) ([]Leak, error) {
+	mailboxes, err := ListMailboxes(ctx, db, account)
+	if err != nil {
+		return nil, err
+	}
+
+	var leaks []Leak
+	for _, mailbox := range mailboxes {
+		site := mailbox.GivenTo()
+		if site == "" {
+			continue
+		}
+
+		var mails []Mail
+		err := db.
+			NewSelect().
+			Model(&mails).
+			Where("mailbox_id = ?", mailbox.ID).
+			Order("id DESC").
+			Scan(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not query mails")
+		}
+
+		for _, mail := range mails {
+			sender := senderDomain(mail.FromAddress)
+			if sender == "" || relatedDomains(site, sender) {
+				continue
+			}
+
+			leaks = append(leaks, Leak{
+				Mailbox: mailbox,
+				Mail:    mail,
+				Site:    site,
+				Sender:  sender,
+			})
+		}
+	}
+
+	return leaks, nil
+}
+
+// Returns the site the mailbox was given out to. It falls back to the
+// label when it looks like a domain.
+func (m Mailbox) GivenTo() string {
+	if m.Site != "" {
+		return m.Site
+	}
+
+	label := strings.TrimSpace(m.Label)
+	if strings.Contains(label, ".") && !strings.ContainsAny(label, " \t@") {
+		return NormalizeSite(label)
+	}
+
+	return ""
+}
+
+func senderDomain(address string) string {
+	_, domain, ok := strings.Cut(address, "@")
+	if !ok {
+		return ""
+	}
+	return NormalizeSite(domain)
+}
+
+// Checks if the sender domain plausibly belongs to the site. They are
+// considered related when they share the registrable domain, or, when the
+// name of the sender domain contains the name of the site, like in the case
+// of github.com and githubmail.com.
+func relatedDomains(site string, sender string) bool {
+	site = registrableDomain(site)
+	sender = registrableDomain(sender)
+	if site == sender {
+		return true
+	}
+
+	name, _, _ := strings.Cut(site, ".")
+	other, _, _ := strings.Cut(sender, ".")
+	return len(name) >= 3 && strings.Contains(other, name)
+}
+
+// A naive approximation of the registrable domain (eTLD+1). It handles the
+// common two level public suffixes like co.uk without a suffix list.
+func registrableDomain(domain string) string {
+	labels := strings.Split(domain, ".")
+	if len(labels) <= 2 {
+		return domain
+	}
+
+	count := 2
+	if len(labels[len(labels)-1]) == 2 && len(labels[len(labels)-2]) <= 3 {
+		count = 3
+	}
+	return strings.Join(labels[len(labels)-count:], ".")
+}
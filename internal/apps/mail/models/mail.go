@@ -2,9 +2,18 @@ package models
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"log/slog"
+	"mime"
+	netmail "net/mail"
+	"strings"
 	"time"
 
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/config"
+	"github.com/ksdme/mail/internal/utils"
+	"github.com/pkg/errors"
 	"github.com/uptrace/bun"
 )
 
@@ -16,30 +25,398 @@ type Mail struct {
 	Subject     string
 	Text        string
 
+	// The subject with the encoded words on it decoded, it is only kept
+	// around so that the mails can be searched by it.
+	SearchSubject string
+
+	// The html part of the message, if there was one.
+	HTML string
+
+	// The message as it was received, including all the headers and parts.
+	Raw []byte
+
+	// The address the mail was delivered to by the sending server, it can be
+	// different from the recipients on the headers, like with bcc.
+	EnvelopeTo string
+
+	// The threading headers on the mail, the references are separated by
+	// spaces. Mails that refer to each other share the thread id, which is
+	// the id of the first mail on the thread.
+	MessageID  string
+	InReplyTo  string
+	References string
+	ThreadID   int64
+
+	// The one-time code and the verification link found on the mail.
+	Code string
+	Link string
+
 	Seen      bool
 	Important bool
 
+	// The keywords set on the mail by the rules on its mailbox, separated
+	// by spaces.
+	Tags string
+
 	MailboxID int64    `bun:",notnull"`
 	Mailbox   *Mailbox `bun:"rel:belongs-to,join:mailbox_id=id,on_delete:cascade"`
 
 	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+
+	// Deleted mails are kept in the trash for a while, they are left out of
+	// the queries on the model unless they are asked for explicitly.
+	DeletedAt time.Time `bun:",soft_delete,nullzero"`
 }
 
-// A method that will clean up stale emails.
+// Returns the subject with the encoded words on it, like the ones used for
+// non-ascii characters, decoded. It is stored exactly as it was received.
+// The encoded words can hide control characters, so, they are stripped.
+func (m Mail) DisplaySubject() string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(m.Subject)
+	if err != nil {
+		decoded = m.Subject
+	}
+	return utils.StripControl(decoded)
+}
+
+// Returns the message as it was received. Mails that were received before
+// the messages were kept around are put back together from what is left.
+func (m Mail) Message() []byte {
+	if len(m.Raw) > 0 {
+		return m.Raw
+	}
+
+	to := m.EnvelopeTo
+	if to == "" && m.Mailbox != nil {
+		to = m.Mailbox.Email()
+	}
+
+	var b strings.Builder
+	from := &netmail.Address{Name: m.FromName, Address: m.FromAddress}
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", m.CreatedAt.Format(time.RFC1123Z))
+	if m.MessageID != "" {
+		fmt.Fprintf(&b, "Message-ID: %s\r\n", m.MessageID)
+	}
+	fmt.Fprintf(&b, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&b, "Content-Type: text/plain; charset=utf-8\r\n")
+	fmt.Fprintf(&b, "\r\n%s\r\n", m.Text)
+	return []byte(b.String())
+}
+
+// A method that will clean up stale emails. Mails are kept around for the
+// retention configured on their mailbox or account, and, important (pinned)
+// mails are never cleaned up.
 func CleanupMails(ctx context.Context, db *bun.DB) error {
 	slog.Info("cleaning up stale mails")
 
-	// Delete all mails that are older than 48 hours.
-	results, err := db.NewDelete().
-		Model(&Mail{}).
-		Where("created_at <= ?", time.Now().Add(-48*time.Hour)).
+	var mailboxes []Mailbox
+	if err := db.NewSelect().Model(&mailboxes).Scan(ctx); err != nil {
+		slog.Debug("could not query mailboxes", "err", err)
+		return nil
+	}
+
+	var settings []Settings
+	if err := db.NewSelect().Model(&settings).Scan(ctx); err != nil {
+		slog.Debug("could not query settings", "err", err)
+		return nil
+	}
+	accounts := make(map[int64]*Settings)
+	for index := range settings {
+		accounts[settings[index].AccountID] = &settings[index]
+	}
+
+	var total int64
+	for _, mailbox := range mailboxes {
+		retention := mailbox.EffectiveRetention(accounts[mailbox.AccountID])
+
+		results, err := db.NewDelete().
+			Model(&Mail{}).
+			Where("mailbox_id = ?", mailbox.ID).
+			Where("important = ?", false).
+			Where("created_at <= ?", time.Now().Add(-retention)).
+			ForceDelete().
+			Exec(ctx)
+		if err != nil {
+			slog.Debug("could not clean up stale mails", "mailbox", mailbox.ID, "err", err)
+			continue
+		}
+
+		rows, _ := results.RowsAffected()
+		total += rows
+	}
+
+	slog.Debug("cleaned up stale mails", "count", total)
+	return nil
+}
+
+// Lists all the mails on the mailbox, newest first.
+func ListMails(ctx context.Context, db *bun.DB, mailbox Mailbox) ([]Mail, error) {
+	var mails []Mail
+	err := db.
+		NewSelect().
+		Model(&mails).
+		Where("mailbox_id = ?", mailbox.ID).
+		Order("id DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query mails")
+	}
+	return mails, nil
+}
+
+// Lists the mails on the mailbox, or, on all the mailboxes on the account if
+// it is nil, oldest first.
+func ListAccountMails(
+	ctx context.Context,
+	db *bun.DB,
+	account accounts.Account,
+	mailbox *Mailbox,
+) ([]Mail, error) {
+	var mails []Mail
+	query := db.
+		NewSelect().
+		Model(&mails).
+		Relation("Mailbox").
+		Where("mailbox.account_id = ?", account.ID).
+		Order("mail.id ASC")
+	if mailbox != nil {
+		query = query.Where("mail.mailbox_id = ?", mailbox.ID)
+	}
+	if err := query.Scan(ctx); err != nil {
+		return nil, errors.Wrap(err, "could not query mails")
+	}
+	return mails, nil
+}
+
+// Returns the most recent mail on the mailbox that carries a one-time code.
+func LatestCode(ctx context.Context, db *bun.DB, mailbox Mailbox) (*Mail, error) {
+	mail := &Mail{}
+	err := db.
+		NewSelect().
+		Model(mail).
+		Where("mailbox_id = ?", mailbox.ID).
+		Where("code != ''").
+		Order("id DESC").
+		Limit(1).
+		Scan(ctx)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("no codes were received on the mailbox")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "could not query mails")
+	}
+	return mail, nil
+}
+
+// Finds a mail on any of the mailboxes on the account.
+func GetAccountMail(ctx context.Context, db *bun.DB, account accounts.Account, id int64) (*Mail, error) {
+	mail := &Mail{}
+	err := db.
+		NewSelect().
+		Model(mail).
+		Relation("Mailbox").
+		Where("mail.id = ?", id).
+		Where("mailbox.account_id = ?", account.ID).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown mail: %d", id)
+		}
+		return nil, errors.Wrap(err, "could not query mails")
+	}
+	return mail, nil
+}
+
+// Marks or unmarks the mail as important. Important mails are pinned,
+// and, they are exempt from clean up.
+func (m *Mail) SetImportant(ctx context.Context, db *bun.DB, important bool) error {
+	m.Important = important
+	_, err := db.NewUpdate().Model(m).Column("important").WherePK().Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update mail")
+	}
+	return nil
+}
+
+// Marks the mail as seen. If the mailbox has burn after read enabled, the
+// mail is deleted instead. Returns a boolean indicating if it was deleted.
+func (m *Mail) MarkSeen(ctx context.Context, db *bun.DB, mailbox Mailbox) (bool, error) {
+	if mailbox.BurnAfterRead {
+		_, err := db.NewDelete().Model(m).WherePK().ForceDelete().Exec(ctx)
+		if err != nil {
+			return false, errors.Wrap(err, "could not delete mail")
+		}
+		return true, nil
+	}
+
+	m.Seen = true
+	_, err := db.NewUpdate().Model(m).Column("seen").WherePK().Exec(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "could not update mail")
+	}
+	return false, nil
+}
+
+// Marks the mails as seen or unseen. Unlike opening a mail, it does not
+// delete the mails on burn after read mailboxes.
+func SetMailsSeen(ctx context.Context, db *bun.DB, ids []int64, seen bool) error {
+	_, err := db.
+		NewUpdate().
+		Model((*Mail)(nil)).
+		Set("seen = ?", seen).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update mails")
+	}
+	return nil
+}
+
+// Marks or unmarks the mails as important.
+func SetMailsImportant(ctx context.Context, db *bun.DB, ids []int64, important bool) error {
+	_, err := db.
+		NewUpdate().
+		Model((*Mail)(nil)).
+		Set("important = ?", important).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update mails")
+	}
+	return nil
+}
+
+// Moves the mails to the trash.
+func DeleteMails(ctx context.Context, db *bun.DB, ids []int64) error {
+	_, err := db.
+		NewDelete().
+		Model((*Mail)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not delete mails")
+	}
+	return nil
+}
+
+// Deletes the mails for good, like opening them on a burn after read
+// mailbox does. Unlike DeleteMails, they do not go through the trash.
+func BurnMails(ctx context.Context, db *bun.DB, ids []int64) error {
+	_, err := db.
+		NewDelete().
+		Model((*Mail)(nil)).
+		Where("id IN (?)", bun.In(ids)).
+		ForceDelete().
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not delete mails")
+	}
+	return nil
+}
+
+// Brings the mails back from the trash.
+func RestoreMails(ctx context.Context, db *bun.DB, ids []int64) error {
+	_, err := db.
+		NewUpdate().
+		Model((*Mail)(nil)).
+		Set("deleted_at = NULL").
+		Where("id IN (?)", bun.In(ids)).
+		WhereDeleted().
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not restore mails")
+	}
+	return nil
+}
+
+// Lists the mails in the trash across all the mailboxes on the account.
+// The mails on deleted mailboxes are left out, they are restored along with
+// their mailbox.
+func ListTrashedMails(ctx context.Context, db *bun.DB, account accounts.Account) ([]Mail, error) {
+	// Relations cannot be used here, asking for deleted mails makes the
+	// relations look for deleted mailboxes too.
+	var mails []Mail
+	err := db.
+		NewSelect().
+		Model(&mails).
+		Where("mailbox_id IN (?)", accountMailboxes(db, account)).
+		WhereDeleted().
+		Order("deleted_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query mails")
+	}
+	return mails, nil
+}
+
+// Finds a mail in the trash on any of the mailboxes on the account.
+func GetTrashedMail(ctx context.Context, db *bun.DB, account accounts.Account, id int64) (*Mail, error) {
+	mail := &Mail{}
+	err := db.
+		NewSelect().
+		Model(mail).
+		Where("id = ?", id).
+		Where("mailbox_id IN (?)", accountMailboxes(db, account)).
+		WhereDeleted().
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown mail in trash: %d", id)
+		}
+		return nil, errors.Wrap(err, "could not query mails")
+	}
+	return mail, nil
+}
+
+// Returns a sub query for the ids of the mailboxes on the account.
+func accountMailboxes(db *bun.DB, account accounts.Account) *bun.SelectQuery {
+	return db.
+		NewSelect().
+		Model((*Mailbox)(nil)).
+		Column("id").
+		Where("account_id = ?", account.ID)
+}
+
+// A method that will purge the mails and mailboxes that were in the trash
+// for longer than the configured period.
+func PurgeTrash(ctx context.Context, db *bun.DB) error {
+	before := time.Now().Add(-config.Mail.TrashRetention)
+
+	results, err := db.
+		NewDelete().
+		Model((*Mail)(nil)).
+		WhereDeleted().
+		Where("deleted_at <= ?", before).
+		ForceDelete().
 		Exec(ctx)
 	if err != nil {
-		slog.Debug("could not clean up stale mails", "err", err)
+		slog.Debug("could not purge mails", "err", err)
+	} else {
+		rows, _ := results.RowsAffected()
+		slog.Debug("purged mails", "count", rows)
+	}
+
+	var mailboxes []Mailbox
+	err = db.
+		NewSelect().
+		Model(&mailboxes).
+		WhereDeleted().
+		Where("deleted_at <= ?", before).
+		Scan(ctx)
+	if err != nil {
+		slog.Debug("could not query deleted mailboxes", "err", err)
 		return nil
 	}
 
-	rows, _ := results.RowsAffected()
-	slog.Debug("cleaned up stale mails", "count", rows)
+	for _, mailbox := range mailboxes {
+		if err := mailbox.Purge(ctx, db); err != nil {
+			slog.Debug("could not purge mailbox", "mailbox", mailbox.ID, "err", err)
+			continue
+		}
+		slog.Debug("purged mailbox", "mailbox", mailbox.ID)
+	}
+
 	return nil
 }
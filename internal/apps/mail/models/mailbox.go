@@ -7,8 +7,11 @@ import (
 	"log/slog"
 	"regexp"
 	"strings"
+	"time"
 
 	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/sieve"
 	"github.com/ksdme/mail/internal/config"
 	"github.com/ksdme/mail/internal/utils"
 	"github.com/pkg/errors"
@@ -34,25 +37,101 @@ const (
 	randomMailboxNameMinSize = 18
 )
 
-// TODO: Add CreatedAt, UpdatedAt fields.
+// TODO: Add UpdatedAt field.
 type Mailbox struct {
 	ID   int64  `bun:",pk,autoincrement"`
 	Name string `bun:",notnull"`
 
+	// The domain the mailbox receives mails on, the names are unique across
+	// all of them. Mailboxes without one are on the mx host.
+	Domain string
+
+	// Optional details to help tell mailboxes apart. The site is the
+	// domain of the website the address was given out to.
+	Label string
+	Note  string
+	Site  string
+
+	// How long mails on the mailbox are kept around, zero means the account
+	// or the server default.
+	Retention time.Duration
+
+	// Lifecycle policies. An expired mailbox is deleted, a mailbox stops
+	// accepting mails once it received MaxMails mails, and, mails on a
+	// burn after read mailbox are deleted once they are seen.
+	ExpiresAt     time.Time `bun:",nullzero"`
+	MaxMails      int       `bun:",notnull,default:0"`
+	Received      int       `bun:",notnull,default:0"`
+	BurnAfterRead bool      `bun:",notnull,default:false"`
+
+	// The sieve script that is run on the mails delivered to the mailbox.
+	Rules string
+
 	AccountID int64             `bun:",notnull"`
 	Account   *accounts.Account `bun:"rel:belongs-to,join:account_id=id,on_delete:cascade"`
+
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+
+	// Deleted mailboxes are kept in the trash for a while along with their
+	// mails, they do not accept any mails in the meantime.
+	DeletedAt time.Time `bun:",soft_delete,nullzero"`
 }
 
 func (m Mailbox) Email() string {
-	return fmt.Sprintf("%s@%s", m.Name, config.Mail.MXHost)
+	return fmt.Sprintf("%s@%s", m.Name, m.host())
+}
+
+func (m Mailbox) host() string {
+	if m.Domain == "" {
+		return config.Mail.MXHost
+	}
+	return m.Domain
+}
+
+// Returns a boolean indicating if the mailbox is past its expiry.
+func (m Mailbox) Expired() bool {
+	return !m.ExpiresAt.IsZero() && time.Now().After(m.ExpiresAt)
+}
+
+// Returns an error if the mailbox should not accept any more mails.
+func (m Mailbox) Accepting() error {
+	if m.Expired() {
+		return fmt.Errorf("mailbox has expired")
+	}
+	if m.MaxMails > 0 && m.Received >= m.MaxMails {
+		return fmt.Errorf("mailbox is not accepting any more mails")
+	}
+	return nil
+}
+
+// Returns the label on the mailbox if there is one, otherwise, the email.
+func (m Mailbox) DisplayName() string {
+	if m.Label != "" {
+		return m.Label
+	}
+	return m.Email()
 }
 
 func createMailbox(
 	ctx context.Context,
-	db *bun.DB,
+	db bun.IDB,
 	account accounts.Account,
 	name string,
+	domain string,
 ) (*Mailbox, error) {
+	// Mailboxes on the mx host are stored without a domain, so that they
+	// follow it around if it is ever changed.
+	domain = normalizeDomain(domain)
+	if domain == config.Mail.Domains()[0] {
+		domain = ""
+	} else if domain != "" {
+		if allowed, err := domainAllowed(ctx, db, account, domain); err != nil {
+			return nil, err
+		} else if !allowed {
+			return nil, errors.Wrapf(ErrInvalidMailbox, "unknown domain %s", domain)
+		}
+	}
+
 	name = normalizeMailbox(name)
 	if len(name) <= 2 {
 		return nil, errors.Wrap(
@@ -95,7 +174,7 @@ func createMailbox(
 	}
 
 	// Create the mailbox while checking for duplicate.
-	mailbox := &Mailbox{Name: name, AccountID: account.ID}
+	mailbox := &Mailbox{Name: name, Domain: domain, AccountID: account.ID}
 	if _, err := db.NewInsert().Model(mailbox).Exec(ctx); err != nil {
 		if utils.IsUniqueConstraintErr(err) {
 			return nil, errors.Wrap(
@@ -114,30 +193,286 @@ func createMailbox(
 	return mailbox, nil
 }
 
-// Create a mailbox against this account with a random name.
+// Create a mailbox against this account with a random name. The mailbox is
+// put on the mx host unless a domain is given.
 func CreateRandomMailbox(
 	ctx context.Context,
 	db *bun.DB,
 	account accounts.Account,
+	domain string,
+) (*Mailbox, error) {
+	name, err := generateMailboxName(ctx, db, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return createMailbox(ctx, db, account, name, domain)
+}
+
+// Create a mailbox meant to be given out to a specific site. The name of the
+// mailbox is prefixed with the name of the site so that it is recognisable.
+func CreateSiteMailbox(
+	ctx context.Context,
+	db *bun.DB,
+	account accounts.Account,
+	site string,
+	domain string,
 ) (*Mailbox, error) {
+	site = NormalizeSite(site)
+	if site == "" {
+		return nil, errors.Wrap(ErrInvalidMailbox, "invalid site")
+	}
+
+	var mailbox *Mailbox
+	err := db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		name, err := generateMailboxName(ctx, tx, sitePrefix(site))
+		if err != nil {
+			return err
+		}
+
+		mailbox, err = createMailbox(ctx, tx, account, name, domain)
+		if err != nil {
+			return err
+		}
+
+		mailbox.Site = site
+		if _, err := tx.NewUpdate().Model(mailbox).Column("site").WherePK().Exec(ctx); err != nil {
+			return errors.Wrap(err, "could not save the mailbox site")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return mailbox, nil
+}
+
+// Update the label and the note on the mailbox. Nil values are left untouched.
+func (m *Mailbox) Describe(ctx context.Context, db bun.IDB, label *string, note *string) error {
+	if label != nil {
+		m.Label = strings.TrimSpace(*label)
+	}
+	if note != nil {
+		m.Note = strings.TrimSpace(*note)
+	}
+
+	_, err := db.NewUpdate().Model(m).Column("label", "note").WherePK().Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update mailbox")
+	}
+	return nil
+}
+
+// Update how long mails are kept around on the mailbox. A zero value
+// falls back to the account or the server default.
+func (m *Mailbox) SetRetention(ctx context.Context, db *bun.DB, retention time.Duration) error {
+	m.Retention = retention
+	_, err := db.NewUpdate().Model(m).Column("retention").WherePK().Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update mailbox")
+	}
+	return nil
+}
+
+// Update the lifecycle policies on the mailbox.
+func (m *Mailbox) SetPolicy(
+	ctx context.Context,
+	db *bun.DB,
+	expiresAt time.Time,
+	maxMails int,
+	burnAfterRead bool,
+) error {
+	if maxMails < 0 {
+		return errors.Wrap(ErrInvalidMailbox, "max mails cannot be negative")
+	}
+
+	m.ExpiresAt = expiresAt
+	m.MaxMails = maxMails
+	m.BurnAfterRead = burnAfterRead
+
+	_, err := db.
+		NewUpdate().
+		Model(m).
+		Column("expires_at", "max_mails", "burn_after_read").
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update mailbox")
+	}
+	return nil
+}
+
+// Update the sieve rules on the mailbox. The rules are validated before they
+// are saved, mails can only be redirected to other mailboxes on the account.
+func (m *Mailbox) SetRules(ctx context.Context, db *bun.DB, rules string) error {
+	if strings.TrimSpace(rules) != "" {
+		script, err := sieve.Parse(rules)
+		if err != nil {
+			return errors.Wrap(err, "invalid rules")
+		}
+
+		account := accounts.Account{ID: m.AccountID}
+		for _, address := range script.Redirects() {
+			target, err := GetAccountMailbox(ctx, db, account, address)
+			if err != nil {
+				return fmt.Errorf("cannot redirect to %s, only mailboxes on your account are allowed", address)
+			}
+			if target.ID == m.ID {
+				return fmt.Errorf("cannot redirect to %s, it is the same mailbox", address)
+			}
+		}
+	} else {
+		rules = ""
+	}
+
+	m.Rules = rules
+	_, err := db.NewUpdate().Model(m).Column("rules").WherePK().Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update mailbox")
+	}
+	return nil
+}
+
+// Records a mail delivery on the mailbox. Returns false if the mailbox hit
+// its limit and the mail should not be delivered. It should run in the same
+// transaction as the insert of the mail, so that a failed insert does not
+// count against the limit.
+func (m *Mailbox) RecordDelivery(ctx context.Context, db bun.IDB) (bool, error) {
+	// Check and increment the count at the same time to prevent racing
+	// deliveries from going over the limit.
+	result, err := db.
+		NewUpdate().
+		Model((*Mailbox)(nil)).
+		Set("received = received + 1").
+		Where("id = ?", m.ID).
+		Where("max_mails = 0 OR received < max_mails").
+		Exec(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "could not update mailbox")
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return false, errors.Wrap(err, "could not update mailbox")
+	} else if affected == 0 {
+		return false, nil
+	}
+
+	m.Received += 1
+	return true, nil
+}
+
+// Moves the mailbox to the trash, its mails go along with it.
+func (m Mailbox) Delete(ctx context.Context, db *bun.DB) error {
+	_, err := db.
+		NewDelete().
+		Model((*Mailbox)(nil)).
+		Where("id = ?", m.ID).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not delete mailbox")
+	}
+	return nil
+}
+
+// Brings the mailbox back from the trash.
+func (m Mailbox) Restore(ctx context.Context, db *bun.DB) error {
+	_, err := db.
+		NewUpdate().
+		Model((*Mailbox)(nil)).
+		Set("deleted_at = NULL").
+		Where("id = ?", m.ID).
+		WhereDeleted().
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not restore mailbox")
+	}
+	return nil
+}
+
+// Permanently delete the mailbox along with all of its mails and senders.
+func (m Mailbox) Purge(ctx context.Context, db *bun.DB) error {
+	return db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.
+			NewDelete().
+			Model(&Mail{}).
+			Where("mailbox_id = ?", m.ID).
+			WhereAllWithDeleted().
+			ForceDelete().
+			Exec(ctx)
+		if err != nil {
+			return errors.Wrap(err, "could not delete mails")
+		}
+
+		_, err = tx.
+			NewDelete().
+			Model((*SenderFilter)(nil)).
+			Where("mailbox_id = ?", m.ID).
+			Exec(ctx)
+		if err != nil {
+			return errors.Wrap(err, "could not delete senders")
+		}
+
+		_, err = tx.
+			NewDelete().
+			Model(&Mailbox{}).
+			Where("id = ?", m.ID).
+			WhereAllWithDeleted().
+			ForceDelete().
+			Exec(ctx)
+		if err != nil {
+			return errors.Wrap(err, "could not delete mailbox")
+		}
+
+		return nil
+	})
+}
+
+// A method that will clean up expired mailboxes.
+func CleanupMailboxes(ctx context.Context, db *bun.DB) error {
+	var mailboxes []Mailbox
+	err := db.
+		NewSelect().
+		Model(&mailboxes).
+		Where("expires_at IS NOT NULL").
+		Where("expires_at <= ?", time.Now()).
+		Scan(ctx)
+	if err != nil {
+		slog.Debug("could not query expired mailboxes", "err", err)
+		return nil
+	}
+
+	for _, mailbox := range mailboxes {
+		if err := mailbox.Purge(ctx, db); err != nil {
+			slog.Debug("could not clean up expired mailbox", "mailbox", mailbox.ID, "err", err)
+			continue
+		}
+
+		slog.Debug("cleaned up expired mailbox", "mailbox", mailbox.ID)
+		events.MailboxContentsUpdatedSignal.Emit(mailbox.AccountID, mailbox.ID)
+	}
+
+	return nil
+}
+
+// Generates an unused random mailbox name with an optional alphabetic prefix.
+func generateMailboxName(ctx context.Context, db bun.IDB, prefix string) (string, error) {
 	var name string
 	// Keep looping until we find a free name.
 	// TODO: We should cap this.
 	for {
-		name = ""
-		for len(name) < randomMailboxNameMinSize {
+		name = prefix
+		for len(name) < randomMailboxNameMinSize || name == prefix {
 			name += utils.Words[rand.Intn(len(utils.Words))]
 		}
 		name = normalizeMailbox(name)
 
-		if exists, err := db.NewSelect().Model(&Mailbox{}).Where("name = ?", name).Exists(ctx); err != nil {
-			return nil, errors.Wrap(err, "error while finding an unused name")
+		if exists, err := db.NewSelect().Model(&Mailbox{}).Where("name = ?", name).WhereAllWithDeleted().Exists(ctx); err != nil {
+			return "", errors.Wrap(err, "error while finding an unused name")
 		} else if !exists {
-			break
+			return name, nil
 		}
 	}
-
-	return createMailbox(ctx, db, account, name)
 }
 
 // Generate a mailbox based on the configured prefix on the account.
@@ -146,6 +481,7 @@ func CreateWildcardMailbox(
 	db *bun.DB,
 	account accounts.Account,
 	suffix string,
+	domain string,
 ) (*Mailbox, error) {
 	if !account.ReservedPrefix.Valid {
 		return nil, fmt.Errorf("no mailbox prefix configured for the account")
@@ -160,19 +496,25 @@ func CreateWildcardMailbox(
 		db,
 		account,
 		fmt.Sprintf("%s.%s", account.ReservedPrefix.String, suffix),
+		domain,
 	)
 }
 
-// Finds an existing mailbox with a name or creates one if necessary or possible.
-func GetOrCreateMailbox(ctx context.Context, db *bun.DB, name string) (*Mailbox, error) {
+// Finds an existing mailbox with a name on the domain or creates one if
+// necessary or possible.
+func GetOrCreateMailbox(ctx context.Context, db *bun.DB, name string, domain string) (*Mailbox, error) {
 	name = normalizeMailbox(name)
 
-	// Try finding an existing mailbox.
+	// Try finding an existing mailbox, the ones in the trash included.
 	mailbox := &Mailbox{}
-	if err := db.NewSelect().Model(mailbox).Where("name = ?", name).Scan(ctx); err != nil {
+	if err := db.NewSelect().Model(mailbox).Where("name = ?", name).WhereAllWithDeleted().Scan(ctx); err != nil {
 		if err != sql.ErrNoRows {
 			return nil, errors.Wrap(err, "could not query mailboxes")
 		}
+	} else if !mailbox.DeletedAt.IsZero() {
+		return nil, fmt.Errorf("mailbox was deleted")
+	} else if !strings.EqualFold(mailbox.host(), domain) {
+		return nil, fmt.Errorf("mailbox is not on %s", domain)
 	} else {
 		return mailbox, nil
 	}
@@ -194,12 +536,142 @@ func GetOrCreateMailbox(ctx context.Context, db *bun.DB, name string) (*Mailbox,
 			return nil, errors.Wrap(err, "could not query mailboxes for wildcards")
 		}
 
-		return CreateWildcardMailbox(ctx, db, account, sections[1])
+		return CreateWildcardMailbox(ctx, db, account, sections[1], domain)
 	}
 
 	return nil, fmt.Errorf("could not find or create mailbox")
 }
 
+// Finds a mailbox on the account using its name or email address. The
+// domain on the address needs to be the one the mailbox is on.
+func GetAccountMailbox(
+	ctx context.Context,
+	db *bun.DB,
+	account accounts.Account,
+	name string,
+) (*Mailbox, error) {
+	name = normalizeMailbox(name)
+	name, domain, _ := strings.Cut(name, "@")
+
+	mailbox := &Mailbox{}
+	err := db.
+		NewSelect().
+		Model(mailbox).
+		Where("account_id = ?", account.ID).
+		Where("name = ?", name).
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown mailbox: %s", name)
+		}
+		return nil, errors.Wrap(err, "could not query mailboxes")
+	}
+
+	if domain != "" && !strings.EqualFold(mailbox.host(), domain) {
+		return nil, fmt.Errorf("unknown mailbox: %s@%s", name, domain)
+	}
+
+	return mailbox, nil
+}
+
+// Finds a mailbox in the trash using its name or email address.
+func GetTrashedMailbox(
+	ctx context.Context,
+	db *bun.DB,
+	account accounts.Account,
+	name string,
+) (*Mailbox, error) {
+	name = normalizeMailbox(name)
+	name, _, _ = strings.Cut(name, "@")
+
+	mailbox := &Mailbox{}
+	err := db.
+		NewSelect().
+		Model(mailbox).
+		Where("account_id = ?", account.ID).
+		Where("name = ?", name).
+		WhereDeleted().
+		Scan(ctx)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("unknown mailbox in trash: %s", name)
+		}
+		return nil, errors.Wrap(err, "could not query mailboxes")
+	}
+
+	return mailbox, nil
+}
+
+// Lists the mailboxes in the trash on the account, latest deleted first.
+func ListTrashedMailboxes(ctx context.Context, db *bun.DB, account accounts.Account) ([]Mailbox, error) {
+	var mailboxes []Mailbox
+	err := db.
+		NewSelect().
+		Model(&mailboxes).
+		Where("account_id = ?", account.ID).
+		WhereDeleted().
+		Order("deleted_at DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query mailboxes")
+	}
+	return mailboxes, nil
+}
+
+// Lists all the mailboxes on the account, newest first.
+func ListMailboxes(ctx context.Context, db *bun.DB, account accounts.Account) ([]Mailbox, error) {
+	var mailboxes []Mailbox
+	err := db.
+		NewSelect().
+		Model(&mailboxes).
+		Where("account_id = ?", account.ID).
+		Order("id DESC").
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query mailboxes")
+	}
+	return mailboxes, nil
+}
+
+// Normalizes a site into a bare lower case domain name. For example,
+// https://www.Example.com/signup becomes example.com.
+func NormalizeSite(site string) string {
+	site = strings.TrimSpace(site)
+	site = strings.ToLower(site)
+	if _, after, ok := strings.Cut(site, "://"); ok {
+		site = after
+	}
+	site, _, _ = strings.Cut(site, "/")
+	site, _, _ = strings.Cut(site, ":")
+	site = strings.TrimPrefix(site, "www.")
+	site = strings.Trim(site, ".")
+	return site
+}
+
+// Returns a purely alphabetic prefix derived from the site. Random mailbox
+// names need to stay alphabetic so that they never collide with wildcard
+// mailboxes.
+func sitePrefix(site string) string {
+	labels := strings.Split(site, ".")
+	name := labels[0]
+	if len(labels) >= 2 {
+		name = labels[len(labels)-2]
+	}
+
+	var prefix strings.Builder
+	for _, character := range name {
+		if character >= 'a' && character <= 'z' {
+			prefix.WriteRune(character)
+		}
+	}
+
+	value := prefix.String()
+	if len(value) > wildcardPrefixMaxSize {
+		value = value[:wildcardPrefixMaxSize]
+	}
+	return value
+}
+
 // Normalizes the mailbox name.
 // TODO: It should also deal with unicode characters.
 func normalizeMailbox(name string) string {
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// Creates the full text search index on mails along with the triggers that
+// keep it in sync with the mails table. It is an external content FTS5 table,
+// so, sqlite needs to be built with FTS5 support (the sqlite_fts5 build tag).
+// The decoded subject is indexed, since, the subject is stored as received.
+func CreateSearchIndex(ctx context.Context, db *bun.DB) error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS mails_search USING fts5(
+			search_subject, from_name, from_address, text,
+			content='mails', content_rowid='id'
+		)`,
+		`CREATE TRIGGER IF NOT EXISTS mails_search_insert AFTER INSERT ON mails BEGIN
+			INSERT INTO mails_search(rowid, search_subject, from_name, from_address, text)
+			VALUES (new.id, new.search_subject, new.from_name, new.from_address, new.text);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS mails_search_delete AFTER DELETE ON mails BEGIN
+			INSERT INTO mails_search(mails_search, rowid, search_subject, from_name, from_address, text)
+			VALUES ('delete', old.id, old.search_subject, old.from_name, old.from_address, old.text);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS mails_search_update
+		AFTER UPDATE OF search_subject, from_name, from_address, text ON mails BEGIN
+			INSERT INTO mails_search(mails_search, rowid, search_subject, from_name, from_address, text)
+			VALUES ('delete', old.id, old.search_subject, old.from_name, old.from_address, old.text);
+			INSERT INTO mails_search(rowid, search_subject, from_name, from_address, text)
+			VALUES (new.id, new.search_subject, new.from_name, new.from_address, new.text);
+		END`,
+		// Index the mails that existed before the index was created.
+		`INSERT INTO mails_search(mails_search) VALUES ('rebuild')`,
+	}
+
+	for _, statement := range statements {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return errors.Wrap(err, "could not create search index")
+		}
+	}
+
+	return nil
+}
+
+// Searches the subject, sender and body of all the mails on the account.
+// Every word in the query needs to match, and, the last word is treated
+// as a prefix. The results are ordered by relevance.
+func SearchMails(
+	ctx context.Context,
+	db *bun.DB,
+	account accounts.Account,
+	query string,
+	limit int,
+) ([]Mail, error) {
+	match := makeMatchExpression(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	var mails []Mail
+	err := db.
+		NewSelect().
+		Model(&mails).
+		Relation("Mailbox").
+		Join("JOIN mails_search").
+		JoinOn("mails_search.rowid = mail.id").
+		Where("mails_search MATCH ?", match).
+		Where("mailbox.account_id = ?", account.ID).
+		OrderExpr("mails_search.rank").
+		Limit(limit).
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not search mails")
+	}
+
+	return mails, nil
+}
+
+// Converts a free-form query into an FTS5 match expression. Each word is
+// quoted so that the query syntax cannot be abused or broken by symbols.
+func makeMatchExpression(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+
+	if len(terms) == 0 {
+		return ""
+	}
+	return strings.Join(terms, " ") + "*"
+}
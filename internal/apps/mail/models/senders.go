@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"time"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// A sender that is allowed or blocked on a mailbox. Once a mailbox has any
+// allowed senders, mails from everyone else are rejected.
+type SenderFilter struct {
+	ID int64 `bun:",pk,autoincrement"`
+
+	// Either the address or the domain of the sender.
+	Sender string `bun:",notnull"`
+	Allow  bool   `bun:",notnull,default:false"`
+
+	MailboxID int64    `bun:",notnull"`
+	Mailbox   *Mailbox `bun:"rel:belongs-to,join:mailbox_id=id,on_delete:cascade"`
+
+	CreatedAt time.Time `bun:",nullzero,notnull,default:current_timestamp"`
+}
+
+// Returns a boolean indicating if the filter applies to the sender.
+func (f SenderFilter) Matches(address string) bool {
+	return MatchesSender(f.Sender, address)
+}
+
+// Returns "allow" or "block" depending on the kind of the filter.
+func (f SenderFilter) Kind() string {
+	if f.Allow {
+		return "allow"
+	}
+	return "block"
+}
+
+// Allows or blocks a sender on the mailbox. A sender that is already on the
+// mailbox is switched over instead of being added twice.
+func CreateSenderFilter(
+	ctx context.Context,
+	db *bun.DB,
+	mailbox Mailbox,
+	sender string,
+	allow bool,
+) (*SenderFilter, error) {
+	sender = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(sender)), "@")
+	if sender == "" {
+		return nil, errors.New("sender cannot be empty")
+	}
+	if strings.Contains(sender, "@") {
+		if _, err := mail.ParseAddress(sender); err != nil {
+			return nil, errors.Wrap(err, "invalid sender address")
+		}
+	} else if strings.ContainsAny(sender, " \t<>,;") || !strings.Contains(sender, ".") {
+		return nil, errors.New("invalid sender domain")
+	}
+
+	filter := &SenderFilter{}
+	err := db.
+		NewSelect().
+		Model(filter).
+		Where("mailbox_id = ?", mailbox.ID).
+		Where("sender = ?", sender).
+		Scan(ctx)
+	if err == nil {
+		filter.Allow = allow
+		if _, err := db.NewUpdate().Model(filter).Column("allow").WherePK().Exec(ctx); err != nil {
+			return nil, errors.Wrap(err, "could not update sender")
+		}
+		return filter, nil
+	}
+
+	filter = &SenderFilter{
+		Sender:    sender,
+		Allow:     allow,
+		MailboxID: mailbox.ID,
+	}
+	if _, err := db.NewInsert().Model(filter).Exec(ctx); err != nil {
+		return nil, errors.Wrap(err, "could not create sender")
+	}
+	return filter, nil
+}
+
+func ListSenderFilters(ctx context.Context, db *bun.DB, mailbox Mailbox) ([]SenderFilter, error) {
+	var filters []SenderFilter
+	err := db.
+		NewSelect().
+		Model(&filters).
+		Where("mailbox_id = ?", mailbox.ID).
+		Order("id ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not query senders")
+	}
+	return filters, nil
+}
+
+func DeleteSenderFilter(ctx context.Context, db *bun.DB, account accounts.Account, id int64) error {
+	result, err := db.
+		NewDelete().
+		Model((*SenderFilter)(nil)).
+		Where("id = ?", id).
+		Where("mailbox_id IN (?)", accountMailboxes(db, account)).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not delete sender")
+	}
+	if count, _ := result.RowsAffected(); count == 0 {
+		return errors.New("sender not found")
+	}
+	return nil
+}
+
+// Returns a boolean indicating if mails from the sender are accepted on the
+// mailbox. Blocked senders are always rejected, and, if there are allowed
+// senders, only those are accepted.
+func (m Mailbox) AcceptsSender(ctx context.Context, db *bun.DB, address string) (bool, error) {
+	filters, err := ListSenderFilters(ctx, db, m)
+	if err != nil {
+		return false, err
+	}
+
+	restricted, allowed := false, false
+	for _, filter := range filters {
+		if !filter.Allow && filter.Matches(address) {
+			return false, nil
+		}
+		if filter.Allow {
+			restricted = true
+			allowed = allowed || filter.Matches(address)
+		}
+	}
+	return !restricted || allowed, nil
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/config"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// Account level settings of the mail app.
+type Settings struct {
+	ID int64 `bun:",pk,autoincrement"`
+
+	// How long mails are kept around, zero means the server default.
+	Retention time.Duration
+
+	// How the open sessions on the account announce new mails, the
+	// notifications are sent as terminal escape sequences, empty means off.
+	Notifications string
+	Bell          bool `bun:",notnull,default:false"`
+
+	AccountID int64             `bun:",notnull,unique"`
+	Account   *accounts.Account `bun:"rel:belongs-to,join:account_id=id,on_delete:cascade"`
+}
+
+// Returns the settings on the account. If the account never had any
+// settings saved, the defaults are returned.
+func GetSettings(ctx context.Context, db *bun.DB, account accounts.Account) (*Settings, error) {
+	settings := &Settings{AccountID: account.ID}
+	err := db.
+		NewSelect().
+		Model(settings).
+		Where("account_id = ?", account.ID).
+		Scan(ctx)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, errors.Wrap(err, "could not query settings")
+	}
+	return settings, nil
+}
+
+// Creates or updates the settings.
+func (s *Settings) Save(ctx context.Context, db *bun.DB) error {
+	var err error
+	if s.ID == 0 {
+		_, err = db.NewInsert().Model(s).Exec(ctx)
+	} else {
+		_, err = db.NewUpdate().Model(s).WherePK().Exec(ctx)
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not save settings")
+	}
+	return nil
+}
+
+// Returns how long mails on the mailbox are kept around. The mailbox
+// retention takes precedence over the account one, which takes precedence
+// over the server default.
+func (m Mailbox) EffectiveRetention(settings *Settings) time.Duration {
+	if m.Retention > 0 {
+		return m.Retention
+	}
+	if settings != nil && settings.Retention > 0 {
+		return settings.Retention
+	}
+	return config.Mail.Retention
+}
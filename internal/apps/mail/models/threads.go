@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+var messageIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+// Extracts the message ids from the value of a threading header, like
+// Message-ID, In-Reply-To or References.
+func ParseMessageIDs(value string) []string {
+	return messageIDPattern.FindAllString(value, -1)
+}
+
+// Returns the thread of the mail. Mails that were received before threading
+// was supported are in their own threads.
+func (m Mail) Thread() int64 {
+	if m.ThreadID != 0 {
+		return m.ThreadID
+	}
+	return m.ID
+}
+
+// Returns the message ids the mail refers to.
+func (m Mail) referencedIDs() []string {
+	ids := ParseMessageIDs(m.References)
+	for _, id := range ParseMessageIDs(m.InReplyTo) {
+		found := false
+		for _, existing := range ids {
+			found = found || existing == id
+		}
+		if !found {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Puts the mail on the thread of the mails it refers to on its mailbox, or,
+// otherwise, starts a new thread. The threads of the mails that refer to
+// this one are merged in as well.
+func (m *Mail) AssignThread(ctx context.Context, db *bun.DB) error {
+	thread := m.ID
+
+	if ids := m.referencedIDs(); len(ids) > 0 {
+		var parent Mail
+		err := db.
+			NewSelect().
+			Model(&parent).
+			Column("id", "thread_id").
+			Where("mailbox_id = ?", m.MailboxID).
+			Where("id != ?", m.ID).
+			Where("message_id IN (?)", bun.In(ids)).
+			Order("id ASC").
+			Limit(1).
+			Scan(ctx)
+		if err == nil {
+			thread = parent.Thread()
+		}
+	}
+
+	// Since mails can arrive out of order, look for the threads of the mails
+	// that refer to this one, they all need to be merged.
+	threads := []int64{thread}
+	if m.MessageID != "" {
+		var replies []int64
+		err := db.
+			NewSelect().
+			Model((*Mail)(nil)).
+			ColumnExpr("DISTINCT thread_id").
+			Where("mailbox_id = ?", m.MailboxID).
+			Where("id != ?", m.ID).
+			Where("thread_id != 0").
+			WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+				// The ids are stored separated by spaces, padding them
+				// matches whole ids only, and, unlike LIKE, instr is case
+				// sensitive and has no wildcards.
+				for _, id := range ParseMessageIDs(m.MessageID) {
+					id = " " + id + " "
+					q = q.
+						WhereOr("instr(' ' || in_reply_to || ' ', ?) > 0", id).
+						WhereOr("instr(' ' || ? || ' ', ?) > 0", bun.Ident("references"), id)
+				}
+				return q
+			}).
+			Scan(ctx, &replies)
+		if err != nil {
+			return errors.Wrap(err, "could not query replies")
+		}
+		threads = append(threads, replies...)
+	}
+	thread = slices.Min(threads)
+
+	_, err := db.
+		NewUpdate().
+		Model((*Mail)(nil)).
+		Set("thread_id = ?", thread).
+		Where("mailbox_id = ?", m.MailboxID).
+		WhereGroup(" AND ", func(q *bun.UpdateQuery) *bun.UpdateQuery {
+			return q.
+				Where("id = ?", m.ID).
+				WhereOr("thread_id IN (?)", bun.In(threads))
+		}).
+		Exec(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not update thread")
+	}
+	m.ThreadID = thread
+
+	return nil
+}
@@ -0,0 +1,463 @@
+// Package pop3d is a small POP3 server over the mailboxes on an account. The
+// username picks the account and the mailbox using a token#mailbox
+// convention, without a mailbox, the mails from all of them are listed. Like
+// on imap, the token can be sent as the password instead.
+package pop3d
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/utils"
+	"github.com/pkg/errors"
+	"github.com/uptrace/bun"
+)
+
+// Clients are logged out after being idle for this long.
+const timeout = 10 * time.Minute
+
+type Server struct {
+	Addr   string
+	Domain string
+
+	db *bun.DB
+
+	// Guesses the tokens are limited on each client.
+	throttle *utils.Throttle
+
+	lock     sync.Mutex
+	listener net.Listener
+	conns    map[net.Conn]bool
+	closed   bool
+}
+
+func NewServer(db *bun.DB) *Server {
+	return &Server{
+		db:       db,
+		throttle: utils.NewThrottle(5, 15*time.Minute),
+		conns:    make(map[net.Conn]bool),
+	}
+}
+
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Accepts connections until the server is closed, it returns nil once the
+// server is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	s.lock.Lock()
+	s.listener = listener
+	s.lock.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if s.closed {
+				return nil
+			}
+			return err
+		}
+
+		s.lock.Lock()
+		s.conns[conn] = true
+		s.lock.Unlock()
+
+		go func() {
+			defer func() {
+				s.lock.Lock()
+				delete(s.conns, conn)
+				s.lock.Unlock()
+				conn.Close()
+			}()
+
+			if err := s.handle(conn); err != nil && !errors.Is(err, io.EOF) {
+				slog.Debug("pop3 session ended", "err", err)
+			}
+		}()
+	}
+}
+
+// Stops accepting connections and drops the connected clients, the mails
+// they deleted are left alone.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	if s.listener != nil {
+		return s.listener.Close()
+	}
+	return nil
+}
+
+type session struct {
+	db   *bun.DB
+	conn *textproto.Conn
+
+	remote   net.Addr
+	throttle *utils.Throttle
+
+	// Set once the client is logged in, the mails are the ones that were
+	// there at the time. Deleted mails are only moved to the trash on quit.
+	username string
+	account  *accounts.Account
+	mails    []models.Mail
+	deleted  map[int]bool
+
+	// The mails that were retrieved from burn after read mailboxes, they
+	// are burned once the session ends, even if it did not quit cleanly.
+	burned map[int]bool
+}
+
+func (s *Server) handle(raw net.Conn) error {
+	conn := textproto.NewConn(raw)
+	session := &session{
+		db:       s.db,
+		conn:     conn,
+		remote:   raw.RemoteAddr(),
+		throttle: s.throttle,
+		deleted:  make(map[int]bool),
+		burned:   make(map[int]bool),
+	}
+	defer session.burn()
+
+	if err := session.ok("%s POP3 server ready", s.Domain); err != nil {
+		return err
+	}
+
+	for {
+		raw.SetDeadline(time.Now().Add(timeout))
+
+		line, err := conn.ReadLine()
+		if err != nil {
+			return err
+		}
+
+		command, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+		command = strings.ToUpper(command)
+		slog.Debug("> pop3", "command", command)
+
+		if command == "QUIT" {
+			return session.quit()
+		}
+		if err := session.dispatch(command, strings.Fields(args)); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *session) dispatch(command string, args []string) error {
+	switch command {
+	case "CAPA":
+		return s.lines("Capability list follows", []string{"USER", "UIDL", "TOP", "RESP-CODES"})
+
+	case "NOOP":
+		return s.ok("")
+	}
+
+	if s.account == nil {
+		switch command {
+		case "USER":
+			if len(args) != 1 {
+				return s.err("USER takes a username")
+			}
+			s.username = args[0]
+			return s.ok("send the token, or anything if the username has it")
+
+		case "PASS":
+			if s.username == "" {
+				return s.err("send USER first")
+			}
+			password := ""
+			if len(args) > 0 {
+				password = args[0]
+			}
+			return s.login(password)
+		}
+		return s.err("log in first")
+	}
+
+	switch command {
+	case "STAT":
+		count, size := 0, 0
+		for index, mail := range s.mails {
+			if !s.deleted[index] {
+				count++
+				size += len(message(mail))
+			}
+		}
+		return s.ok("%d %d", count, size)
+
+	case "LIST", "UIDL":
+		describe := func(index int) string {
+			if command == "UIDL" {
+				return fmt.Sprintf("%d %d", index+1, s.mails[index].ID)
+			}
+			return fmt.Sprintf("%d %d", index+1, len(message(s.mails[index])))
+		}
+
+		if len(args) > 0 {
+			index, err := s.message(args[0])
+			if err != nil {
+				return s.err("%v", err)
+			}
+			return s.ok("%s", describe(index))
+		}
+
+		var lines []string
+		for index := range s.mails {
+			if !s.deleted[index] {
+				lines = append(lines, describe(index))
+			}
+		}
+		return s.lines(fmt.Sprintf("%d messages", len(lines)), lines)
+
+	case "RETR":
+		if len(args) != 1 {
+			return s.err("RETR takes a message number")
+		}
+		index, err := s.message(args[0])
+		if err != nil {
+			return s.err("%v", err)
+		}
+
+		mail := s.mails[index]
+		if err := s.send(message(mail), -1); err != nil {
+			return err
+		}
+
+		if mail.Mailbox != nil && mail.Mailbox.BurnAfterRead {
+			s.burned[index] = true
+		} else if !mail.Seen {
+			if err := models.SetMailsSeen(context.TODO(), s.db, []int64{mail.ID}, true); err != nil {
+				slog.Error("could not mark mail as seen", "mail", mail.ID, "err", err)
+			} else {
+				s.mails[index].Seen = true
+				events.MailboxContentsUpdatedSignal.Emit(s.account.ID, mail.MailboxID)
+			}
+		}
+		return nil
+
+	case "TOP":
+		if len(args) != 2 {
+			return s.err("TOP takes a message number and a number of lines")
+		}
+		index, err := s.message(args[0])
+		if err != nil {
+			return s.err("%v", err)
+		}
+		lines, err := strconv.Atoi(args[1])
+		if err != nil || lines < 0 {
+			return s.err("invalid number of lines")
+		}
+		return s.send(message(s.mails[index]), lines)
+
+	case "DELE":
+		if len(args) != 1 {
+			return s.err("DELE takes a message number")
+		}
+		index, err := s.message(args[0])
+		if err != nil {
+			return s.err("%v", err)
+		}
+		s.deleted[index] = true
+		return s.ok("message %d deleted", index+1)
+
+	case "RSET":
+		s.deleted = make(map[int]bool)
+		return s.ok("")
+	}
+
+	return s.err("unknown command")
+}
+
+// Picks the account using the token on the username, or, on the password
+// when the username only has the mailbox. Usernames without a mailbox are
+// tried as the token first, and, the password after.
+func (s *session) login(password string) error {
+	if !s.throttle.Allowed(s.remote) {
+		s.username = ""
+		return s.err("[AUTH] too many failed logins, try again later")
+	}
+
+	tokens := []string{password}
+	token, mailbox, found := strings.Cut(s.username, "#")
+	if token != "" && found {
+		tokens = []string{token}
+	} else if token != "" {
+		tokens = []string{token, password}
+	}
+
+	ctx := context.TODO()
+	var account *accounts.Account
+	var err error
+	for _, token := range tokens {
+		account, err = accounts.GetAccountFromToken(ctx, s.db, strings.TrimSpace(token))
+		if err != nil {
+			slog.Error("could not query account", "err", err)
+			return s.err("could not log in")
+		}
+		if account != nil {
+			break
+		}
+	}
+	if account == nil {
+		s.throttle.Fail(s.remote)
+		s.username = ""
+		return s.err("[AUTH] invalid credentials")
+	}
+
+	var selected *models.Mailbox
+	if mailbox != "" {
+		selected, err = models.GetAccountMailbox(ctx, s.db, *account, mailbox)
+		if err != nil {
+			s.username = ""
+			return s.err("%v", err)
+		}
+	}
+
+	mails, err := models.ListAccountMails(ctx, s.db, *account, selected)
+	if err != nil {
+		slog.Error("could not list mails", "account", account.ID, "err", err)
+		return s.err("could not list mails")
+	}
+
+	slog.Debug("pop3 client logged in", "account", account.ID, "mailbox", mailbox)
+	s.account = account
+	s.mails = mails
+	return s.ok("%d messages", len(mails))
+}
+
+// Moves the deleted mails to the trash and says goodbye.
+func (s *session) quit() error {
+	if s.account == nil {
+		return s.ok("bye")
+	}
+
+	var ids []int64
+	mailboxes := make(map[int64]bool)
+	for index := range s.deleted {
+		// They are burned right after instead.
+		if s.burned[index] {
+			continue
+		}
+		ids = append(ids, s.mails[index].ID)
+		mailboxes[s.mails[index].MailboxID] = true
+	}
+
+	if len(ids) > 0 {
+		if err := models.DeleteMails(context.TODO(), s.db, ids); err != nil {
+			slog.Error("could not delete mails", "account", s.account.ID, "err", err)
+			return s.err("could not delete mails")
+		}
+		for mailbox := range mailboxes {
+			events.MailboxContentsUpdatedSignal.Emit(s.account.ID, mailbox)
+		}
+	}
+
+	return s.ok("%d messages deleted", len(ids))
+}
+
+// Deletes the mails that were retrieved from burn after read mailboxes for
+// good.
+func (s *session) burn() {
+	if len(s.burned) == 0 {
+		return
+	}
+
+	var ids []int64
+	mailboxes := make(map[int64]bool)
+	for index := range s.burned {
+		ids = append(ids, s.mails[index].ID)
+		mailboxes[s.mails[index].MailboxID] = true
+	}
+
+	if err := models.BurnMails(context.TODO(), s.db, ids); err != nil {
+		slog.Error("could not burn mails", "account", s.account.ID, "err", err)
+		return
+	}
+	for mailbox := range mailboxes {
+		events.MailboxContentsUpdatedSignal.Emit(s.account.ID, mailbox)
+	}
+	s.burned = make(map[int]bool)
+}
+
+// Returns the index of a message that was not deleted using its number.
+func (s *session) message(number string) (int, error) {
+	index, err := strconv.Atoi(number)
+	if err != nil || index < 1 || index > len(s.mails) {
+		return 0, fmt.Errorf("no such message")
+	}
+	if s.deleted[index-1] {
+		return 0, fmt.Errorf("message %d already deleted", index)
+	}
+	return index - 1, nil
+}
+
+// Sends the message, up to the given number of lines of the body if it is
+// not negative.
+func (s *session) send(message []byte, lines int) error {
+	if lines >= 0 {
+		header, body, _ := bytes.Cut(message, []byte("\r\n\r\n"))
+
+		kept := strings.Split(string(body), "\r\n")
+		kept = kept[:min(lines, len(kept))]
+		message = []byte(string(header) + "\r\n\r\n" + strings.Join(kept, "\r\n"))
+	}
+
+	if err := s.ok("%d octets", len(message)); err != nil {
+		return err
+	}
+	writer := s.conn.DotWriter()
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func (s *session) lines(status string, lines []string) error {
+	if err := s.ok("%s", status); err != nil {
+		return err
+	}
+	writer := s.conn.DotWriter()
+	for _, line := range lines {
+		fmt.Fprintf(writer, "%s\n", line)
+	}
+	return writer.Close()
+}
+
+func (s *session) ok(format string, args ...any) error {
+	return s.conn.PrintfLine("%s", strings.TrimSpace("+OK "+fmt.Sprintf(format, args...)))
+}
+
+func (s *session) err(format string, args ...any) error {
+	return s.conn.PrintfLine("-ERR %s", fmt.Sprintf(format, args...))
+}
+
+// Returns the message with crlf line endings, sizes are counted on it.
+func message(mail models.Mail) []byte {
+	raw := bytes.ReplaceAll(mail.Message(), []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(raw, []byte("\n"), []byte("\r\n"))
+}
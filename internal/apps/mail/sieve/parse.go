@@ -0,0 +1,694 @@
+package sieve
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenIdentifier tokenKind = iota
+	tokenTag
+	tokenString
+	tokenNumber
+	tokenSymbol
+	tokenEOF
+)
+
+type token struct {
+	kind   tokenKind
+	value  string
+	number int
+	line   int
+}
+
+// Splits the script into tokens, comments are dropped along the way.
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	line := 1
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line += 1
+			i += 1
+
+		case unicode.IsSpace(r):
+			i += 1
+
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i += 1
+			}
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			i += 2
+			for ; i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/'); i++ {
+				if runes[i] == '\n' {
+					line += 1
+				}
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated comment", start)
+			}
+			i += 2
+
+		case r == '"':
+			start := line
+			var b strings.Builder
+			i += 1
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i += 1
+				}
+				if runes[i] == '\n' {
+					line += 1
+				}
+				b.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("line %d: unterminated string", start)
+			}
+			i += 1
+			tokens = append(tokens, token{kind: tokenString, value: b.String(), line: start})
+
+		case r == ':' && i+1 < len(runes) && isIdentifierStart(runes[i+1]):
+			start := i + 1
+			for i = start; i < len(runes) && isIdentifier(runes[i]); i++ {
+			}
+			tokens = append(tokens, token{
+				kind:  tokenTag,
+				value: strings.ToLower(string(runes[start:i])),
+				line:  line,
+			})
+
+		case unicode.IsDigit(r):
+			start := i
+			for ; i < len(runes) && unicode.IsDigit(runes[i]); i++ {
+			}
+			number, err := strconv.Atoi(string(runes[start:i]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid number", line)
+			}
+			if i < len(runes) {
+				switch unicode.ToUpper(runes[i]) {
+				case 'K':
+					number, i = number*1024, i+1
+				case 'M':
+					number, i = number*1024*1024, i+1
+				case 'G':
+					number, i = number*1024*1024*1024, i+1
+				}
+			}
+			tokens = append(tokens, token{kind: tokenNumber, number: number, line: line})
+
+		case isIdentifierStart(r):
+			start := i
+			for ; i < len(runes) && isIdentifier(runes[i]); i++ {
+			}
+			identifier := strings.ToLower(string(runes[start:i]))
+
+			// Multi-line strings start with text: and end with a line that
+			// only has a period on it.
+			if identifier == "text" && i < len(runes) && runes[i] == ':' {
+				_, next, ok := readLine(runes, i)
+				if !ok {
+					return nil, fmt.Errorf("line %d: unterminated multi-line string", line)
+				}
+				i = next
+				start := line
+				line += 1
+
+				var lines []string
+				for {
+					text, next, ok := readLine(runes, i)
+					if !ok {
+						return nil, fmt.Errorf("line %d: unterminated multi-line string", start)
+					}
+					i = next
+					line += 1
+
+					text = strings.TrimSuffix(text, "\r")
+					if text == "." {
+						break
+					}
+					lines = append(lines, strings.TrimPrefix(text, "."))
+				}
+				tokens = append(tokens, token{
+					kind:  tokenString,
+					value: strings.Join(lines, "\n"),
+					line:  start,
+				})
+				continue
+			}
+
+			tokens = append(tokens, token{kind: tokenIdentifier, value: identifier, line: line})
+
+		case strings.ContainsRune(";,()[]{}", r):
+			tokens = append(tokens, token{kind: tokenSymbol, value: string(r), line: line})
+			i += 1
+
+		default:
+			return nil, fmt.Errorf("line %d: unexpected character %q", line, r)
+		}
+	}
+
+	return append(tokens, token{kind: tokenEOF, line: line}), nil
+}
+
+// Returns the rest of the line starting at i and the position after it.
+func readLine(runes []rune, i int) (string, int, bool) {
+	for end := i; end < len(runes); end++ {
+		if runes[end] == '\n' {
+			return string(runes[i:end]), end + 1, true
+		}
+	}
+	return "", i, false
+}
+
+func isIdentifierStart(r rune) bool {
+	return r == '_' || (r < unicode.MaxASCII && unicode.IsLetter(r))
+}
+
+func isIdentifier(r rune) bool {
+	return isIdentifierStart(r) || (r < unicode.MaxASCII && unicode.IsDigit(r))
+}
+
+// The extensions that can be required by the scripts.
+var extensions = map[string]bool{
+	"imap4flags":                 true,
+	"body":                       true,
+	"envelope":                   true,
+	"comparator-i;ascii-casemap": true,
+	"comparator-i;octet":         true,
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	required map[string]bool
+}
+
+// An argument to a command or a test, either a tag, a number or a list of
+// strings. A single string is treated like a list with one string.
+type argument struct {
+	tag     string
+	strings []string
+	number  int
+	kind    tokenKind
+	line    int
+}
+
+// Parses and validates a script. Errors point at the line with the problem.
+func Parse(source string) (*Script, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, required: make(map[string]bool)}
+	commands, err := p.commands(false)
+	if err != nil {
+		return nil, err
+	}
+	return &Script{commands: commands}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos += 1
+	}
+	return t
+}
+
+func (p *parser) symbol(value string) bool {
+	if t := p.peek(); t.kind == tokenSymbol && t.value == value {
+		p.pos += 1
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(value string) error {
+	if !p.symbol(value) {
+		return p.unexpected(fmt.Sprintf("expected %q", value))
+	}
+	return nil
+}
+
+func (p *parser) unexpected(message string) error {
+	t := p.peek()
+	found := t.value
+	switch t.kind {
+	case tokenEOF:
+		found = "end of script"
+	case tokenTag:
+		found = ":" + t.value
+	case tokenString:
+		found = strconv.Quote(t.value)
+	case tokenNumber:
+		found = strconv.Itoa(t.number)
+	}
+	return fmt.Errorf("line %d: %s, found %s", t.line, message, found)
+}
+
+// Parses commands until the end of the script, or, the end of the block.
+func (p *parser) commands(block bool) ([]command, error) {
+	var commands []command
+	for {
+		if block && p.symbol("}") {
+			return commands, nil
+		}
+		if p.peek().kind == tokenEOF {
+			if block {
+				return nil, p.unexpected(`expected "}"`)
+			}
+			return commands, nil
+		}
+
+		command, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		if command != nil {
+			commands = append(commands, command)
+		}
+	}
+}
+
+func (p *parser) block() ([]command, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	return p.commands(true)
+}
+
+func (p *parser) command() (command, error) {
+	t := p.next()
+	if t.kind != tokenIdentifier {
+		p.pos -= 1
+		return nil, p.unexpected("expected a command")
+	}
+
+	switch t.value {
+	case "require":
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 1 || args[0].kind != tokenString {
+			return nil, fmt.Errorf("line %d: require needs a list of extensions", t.line)
+		}
+		for _, extension := range args[0].strings {
+			extension = strings.ToLower(extension)
+			if !extensions[extension] {
+				return nil, fmt.Errorf("line %d: unsupported extension %q", t.line, extension)
+			}
+			p.required[extension] = true
+		}
+		return nil, p.expect(";")
+
+	case "if":
+		conditional := &ifCommand{}
+		for {
+			test, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			commands, err := p.block()
+			if err != nil {
+				return nil, err
+			}
+			conditional.branches = append(conditional.branches, branch{test, commands})
+
+			if next := p.peek(); next.kind == tokenIdentifier && next.value == "elsif" {
+				p.pos += 1
+				continue
+			}
+			if next := p.peek(); next.kind == tokenIdentifier && next.value == "else" {
+				p.pos += 1
+				commands, err := p.block()
+				if err != nil {
+					return nil, err
+				}
+				conditional.otherwise = commands
+			}
+			return conditional, nil
+		}
+
+	case "elsif", "else":
+		return nil, fmt.Errorf("line %d: %s without an if", t.line, t.value)
+
+	case "keep", "discard", "stop":
+		if err := p.expect(";"); err != nil {
+			return nil, err
+		}
+		return &action{name: t.value}, nil
+
+	case "redirect":
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 1 || args[0].kind != tokenString || len(args[0].strings) != 1 {
+			return nil, fmt.Errorf("line %d: redirect needs an address", t.line)
+		}
+		address, err := mail.ParseAddress(args[0].strings[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid address %q", t.line, args[0].strings[0])
+		}
+		return &action{name: t.value, values: []string{address.Address}}, p.expect(";")
+
+	case "addflag", "setflag", "removeflag":
+		if !p.required["imap4flags"] {
+			return nil, fmt.Errorf("line %d: %s needs the imap4flags extension to be required", t.line, t.value)
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 1 || args[0].kind != tokenString {
+			return nil, fmt.Errorf("line %d: %s needs a list of flags", t.line, t.value)
+		}
+		var flags []string
+		for _, value := range args[0].strings {
+			flags = append(flags, strings.Fields(value)...)
+		}
+		return &action{name: t.value, values: flags}, p.expect(";")
+	}
+
+	return nil, fmt.Errorf("line %d: unsupported command %q", t.line, t.value)
+}
+
+// Parses tags, numbers and strings up until a test or the end of the command.
+func (p *parser) arguments() ([]argument, error) {
+	var args []argument
+	for {
+		t := p.peek()
+		switch {
+		case t.kind == tokenTag:
+			p.pos += 1
+			args = append(args, argument{tag: t.value, kind: tokenTag, line: t.line})
+
+		case t.kind == tokenNumber:
+			p.pos += 1
+			args = append(args, argument{number: t.number, kind: tokenNumber, line: t.line})
+
+		case t.kind == tokenString:
+			p.pos += 1
+			args = append(args, argument{strings: []string{t.value}, kind: tokenString, line: t.line})
+
+		case t.kind == tokenSymbol && t.value == "[":
+			p.pos += 1
+			var values []string
+			for {
+				value := p.next()
+				if value.kind != tokenString {
+					p.pos -= 1
+					return nil, p.unexpected("expected a string")
+				}
+				values = append(values, value.value)
+				if p.symbol("]") {
+					break
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			args = append(args, argument{strings: values, kind: tokenString, line: t.line})
+
+		default:
+			return args, nil
+		}
+	}
+}
+
+func (p *parser) test() (test, error) {
+	t := p.next()
+	if t.kind != tokenIdentifier {
+		p.pos -= 1
+		return nil, p.unexpected("expected a test")
+	}
+
+	switch t.value {
+	case "true", "false":
+		return constantTest(t.value == "true"), nil
+
+	case "not":
+		inner, err := p.test()
+		if err != nil {
+			return nil, err
+		}
+		return notTest{inner}, nil
+
+	case "allof", "anyof":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		var tests []test
+		for {
+			inner, err := p.test()
+			if err != nil {
+				return nil, err
+			}
+			tests = append(tests, inner)
+			if p.symbol(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		return listTest{all: t.value == "allof", tests: tests}, nil
+	}
+
+	args, err := p.arguments()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t.value {
+	case "header":
+		options, positional, err := p.options(t, args, "match")
+		if err != nil {
+			return nil, err
+		}
+		if len(positional) != 2 {
+			return nil, fmt.Errorf("line %d: header needs a list of headers and a list of keys", t.line)
+		}
+		match, err := options.matcher(positional[1], t.line)
+		if err != nil {
+			return nil, err
+		}
+		return headerTest{headers: positional[0], match: match}, nil
+
+	case "address", "envelope":
+		if t.value == "envelope" && !p.required["envelope"] {
+			return nil, fmt.Errorf("line %d: envelope needs the envelope extension to be required", t.line)
+		}
+		options, positional, err := p.options(t, args, "match", "part")
+		if err != nil {
+			return nil, err
+		}
+		if len(positional) != 2 {
+			return nil, fmt.Errorf("line %d: %s needs a list of headers and a list of keys", t.line, t.value)
+		}
+		match, err := options.matcher(positional[1], t.line)
+		if err != nil {
+			return nil, err
+		}
+
+		if t.value == "envelope" {
+			for _, part := range positional[0] {
+				if part := strings.ToLower(part); part != "from" && part != "to" {
+					return nil, fmt.Errorf("line %d: unsupported envelope part %q", t.line, part)
+				}
+			}
+		}
+		return addressTest{
+			envelope: t.value == "envelope",
+			headers:  positional[0],
+			part:     options.part,
+			match:    match,
+		}, nil
+
+	case "body":
+		if !p.required["body"] {
+			return nil, fmt.Errorf("line %d: body needs the body extension to be required", t.line)
+		}
+		options, positional, err := p.options(t, args, "match", "transform")
+		if err != nil {
+			return nil, err
+		}
+		if len(positional) != 1 {
+			return nil, fmt.Errorf("line %d: body needs a list of keys", t.line)
+		}
+		match, err := options.matcher(positional[0], t.line)
+		if err != nil {
+			return nil, err
+		}
+		return bodyTest{match: match}, nil
+
+	case "exists":
+		_, positional, err := p.options(t, args)
+		if err != nil {
+			return nil, err
+		}
+		if len(positional) != 1 {
+			return nil, fmt.Errorf("line %d: exists needs a list of headers", t.line)
+		}
+		return existsTest{headers: positional[0]}, nil
+
+	case "size":
+		if len(args) != 2 ||
+			args[0].kind != tokenTag ||
+			(args[0].tag != "over" && args[0].tag != "under") ||
+			args[1].kind != tokenNumber {
+			return nil, fmt.Errorf("line %d: size needs :over or :under and a number", t.line)
+		}
+		return sizeTest{over: args[0].tag == "over", limit: args[1].number}, nil
+	}
+
+	return nil, fmt.Errorf("line %d: unsupported test %q", t.line, t.value)
+}
+
+// The optional tags on tests.
+type options struct {
+	match      string
+	comparator string
+	part       string
+}
+
+// Splits the arguments into the tags, which are only allowed if they are in
+// one of the allowed groups, and, the positional string lists.
+func (p *parser) options(t token, args []argument, allowed ...string) (options, [][]string, error) {
+	opts := options{match: "is", comparator: "i;ascii-casemap", part: "all"}
+	groups := make(map[string]bool)
+	for _, group := range allowed {
+		groups[group] = true
+	}
+
+	var positional [][]string
+	for index := 0; index < len(args); index++ {
+		arg := args[index]
+		switch arg.kind {
+		case tokenString:
+			positional = append(positional, arg.strings)
+			continue
+		case tokenNumber:
+			return opts, nil, fmt.Errorf("line %d: unexpected number in %s", arg.line, t.value)
+		}
+
+		switch {
+		case groups["match"] && (arg.tag == "is" || arg.tag == "contains" || arg.tag == "matches"):
+			opts.match = arg.tag
+
+		case groups["match"] && arg.tag == "comparator":
+			if index+1 >= len(args) || args[index+1].kind != tokenString || len(args[index+1].strings) != 1 {
+				return opts, nil, fmt.Errorf("line %d: :comparator needs a name", arg.line)
+			}
+			index += 1
+			opts.comparator = strings.ToLower(args[index].strings[0])
+			if opts.comparator != "i;ascii-casemap" && opts.comparator != "i;octet" {
+				return opts, nil, fmt.Errorf("line %d: unsupported comparator %q", arg.line, opts.comparator)
+			}
+
+		case groups["part"] && (arg.tag == "all" || arg.tag == "localpart" || arg.tag == "domain"):
+			opts.part = arg.tag
+
+		// Only the decoded text of the body can be tested.
+		case groups["transform"] && arg.tag == "text":
+
+		default:
+			return opts, nil, fmt.Errorf("line %d: unsupported tag :%s in %s", arg.line, arg.tag, t.value)
+		}
+	}
+
+	return opts, positional, nil
+}
+
+// Compiles the keys into a function that matches values against them.
+func (o options) matcher(keys []string, line int) (matcher, error) {
+	fold := o.comparator == "i;ascii-casemap"
+
+	switch o.match {
+	case "is", "contains":
+		contains := o.match == "contains"
+		return func(value string) bool {
+			for _, key := range keys {
+				v, k := value, key
+				if fold {
+					v, k = strings.ToLower(v), strings.ToLower(k)
+				}
+				if (contains && strings.Contains(v, k)) || (!contains && v == k) {
+					return true
+				}
+			}
+			return false
+		}, nil
+
+	case "matches":
+		var patterns []*regexp.Regexp
+		for _, key := range keys {
+			pattern, err := compileWildcard(key, fold)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid pattern %q", line, key)
+			}
+			patterns = append(patterns, pattern)
+		}
+		return func(value string) bool {
+			for _, pattern := range patterns {
+				if pattern.MatchString(value) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+
+	return nil, fmt.Errorf("line %d: unsupported match type :%s", line, o.match)
+}
+
+// Converts a :matches pattern, where * matches any text and ? matches a
+// single character, into a regular expression.
+func compileWildcard(pattern string, fold bool) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("(?s)")
+	if fold {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '\\':
+			if i+1 < len(runes) {
+				i += 1
+			}
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
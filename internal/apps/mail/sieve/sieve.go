@@ -0,0 +1,319 @@
+// Package sieve implements a subset of the Sieve mail filtering language
+// (RFC 5228) along with the imap4flags, body and envelope extensions.
+package sieve
+
+import (
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// A parsed script, it can be evaluated against any number of messages.
+type Script struct {
+	commands []command
+}
+
+// The message the script is evaluated against.
+type Message struct {
+	// The envelope sender and recipient.
+	From string
+	To   string
+
+	// The decoded headers and the plain text body.
+	Header mail.Header
+	Body   string
+
+	// The size of the raw message in bytes.
+	Size int
+}
+
+// The outcome of evaluating a script against a message.
+type Result struct {
+	// Whether the message should be delivered to the mailbox.
+	Keep bool
+
+	// The flags set on the message, like \Seen or \Flagged, along with the
+	// custom keywords.
+	Flags []string
+
+	// The addresses the message should be redirected to.
+	Redirects []string
+}
+
+type command interface {
+	run(*state, Message)
+}
+
+type test interface {
+	evaluate(Message) bool
+}
+
+type matcher func(string) bool
+
+type state struct {
+	keep      bool
+	cancelled bool
+	stopped   bool
+	flags     []string
+	redirects []string
+}
+
+// Runs the script on the message.
+func (s *Script) Evaluate(message Message) Result {
+	state := &state{}
+	runCommands(s.commands, state, message)
+
+	return Result{
+		Keep:      state.keep || !state.cancelled,
+		Flags:     state.flags,
+		Redirects: state.redirects,
+	}
+}
+
+// Returns all the addresses the script could redirect messages to.
+func (s *Script) Redirects() []string {
+	var addresses []string
+	var walk func([]command)
+	walk = func(commands []command) {
+		for _, c := range commands {
+			switch c := c.(type) {
+			case *action:
+				if c.name == "redirect" {
+					addresses = append(addresses, c.values...)
+				}
+			case *ifCommand:
+				for _, branch := range c.branches {
+					walk(branch.commands)
+				}
+				walk(c.otherwise)
+			}
+		}
+	}
+	walk(s.commands)
+	return addresses
+}
+
+func runCommands(commands []command, state *state, message Message) {
+	for _, c := range commands {
+		if state.stopped {
+			return
+		}
+		c.run(state, message)
+	}
+}
+
+type branch struct {
+	test     test
+	commands []command
+}
+
+type ifCommand struct {
+	branches  []branch
+	otherwise []command
+}
+
+func (c *ifCommand) run(state *state, message Message) {
+	for _, branch := range c.branches {
+		if branch.test.evaluate(message) {
+			runCommands(branch.commands, state, message)
+			return
+		}
+	}
+	runCommands(c.otherwise, state, message)
+}
+
+type action struct {
+	name   string
+	values []string
+}
+
+func (a *action) run(state *state, message Message) {
+	switch a.name {
+	case "keep":
+		state.keep = true
+
+	case "discard":
+		state.cancelled = true
+
+	case "stop":
+		state.stopped = true
+
+	case "redirect":
+		state.cancelled = true
+		for _, address := range a.values {
+			if !containsFold(state.redirects, address) {
+				state.redirects = append(state.redirects, address)
+			}
+		}
+
+	case "setflag":
+		state.flags = nil
+		fallthrough
+
+	case "addflag":
+		for _, flag := range a.values {
+			if !containsFold(state.flags, flag) {
+				state.flags = append(state.flags, flag)
+			}
+		}
+
+	case "removeflag":
+		var flags []string
+		for _, flag := range state.flags {
+			if !containsFold(a.values, flag) {
+				flags = append(flags, flag)
+			}
+		}
+		state.flags = flags
+	}
+}
+
+type constantTest bool
+
+func (t constantTest) evaluate(Message) bool {
+	return bool(t)
+}
+
+type notTest struct {
+	test test
+}
+
+func (t notTest) evaluate(message Message) bool {
+	return !t.test.evaluate(message)
+}
+
+type listTest struct {
+	all   bool
+	tests []test
+}
+
+func (t listTest) evaluate(message Message) bool {
+	for _, test := range t.tests {
+		if test.evaluate(message) != t.all {
+			return !t.all
+		}
+	}
+	return t.all
+}
+
+type headerTest struct {
+	headers []string
+	match   matcher
+}
+
+func (t headerTest) evaluate(message Message) bool {
+	for _, name := range t.headers {
+		for _, value := range message.Header[textproto.CanonicalMIMEHeaderKey(name)] {
+			if t.match(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type addressTest struct {
+	envelope bool
+	headers  []string
+	part     string
+	match    matcher
+}
+
+func (t addressTest) evaluate(message Message) bool {
+	for _, name := range t.headers {
+		var addresses []string
+		if t.envelope {
+			switch strings.ToLower(name) {
+			case "from":
+				addresses = []string{message.From}
+			case "to":
+				addresses = []string{message.To}
+			}
+		} else {
+			for _, value := range message.Header[textproto.CanonicalMIMEHeaderKey(name)] {
+				addresses = append(addresses, parseAddresses(value)...)
+			}
+		}
+
+		for _, address := range addresses {
+			if t.match(addressPart(address, t.part)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type bodyTest struct {
+	match matcher
+}
+
+func (t bodyTest) evaluate(message Message) bool {
+	return t.match(message.Body)
+}
+
+type existsTest struct {
+	headers []string
+}
+
+func (t existsTest) evaluate(message Message) bool {
+	for _, name := range t.headers {
+		if len(message.Header[textproto.CanonicalMIMEHeaderKey(name)]) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type sizeTest struct {
+	over  bool
+	limit int
+}
+
+func (t sizeTest) evaluate(message Message) bool {
+	if t.over {
+		return message.Size > t.limit
+	}
+	return message.Size < t.limit
+}
+
+// Returns the addresses in a header value, or, the value itself if it
+// cannot be parsed as a list of addresses.
+func parseAddresses(value string) []string {
+	list, err := mail.ParseAddressList(value)
+	if err != nil {
+		return []string{strings.TrimSpace(value)}
+	}
+
+	var addresses []string
+	for _, address := range list {
+		addresses = append(addresses, address.Address)
+	}
+	return addresses
+}
+
+func addressPart(address string, part string) string {
+	index := strings.LastIndex(address, "@")
+	switch part {
+	case "localpart":
+		if index < 0 {
+			return address
+		}
+		return address[:index]
+	case "domain":
+		if index < 0 {
+			return ""
+		}
+		return address[index+1:]
+	}
+	return address
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,23 @@
 package email
 
 import (
+	"context"
 	"fmt"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/backend"
+	"github.com/ksdme/mail/internal/apps/mail/extract"
+	linter "github.com/ksdme/mail/internal/apps/mail/lint"
 	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/apps/mail/tui/lint"
+	"github.com/ksdme/mail/internal/core"
 	"github.com/ksdme/mail/internal/core/tui/colors"
 	"github.com/ksdme/mail/internal/utils"
 )
@@ -20,7 +29,40 @@ type MailSelectedMsg struct {
 
 type MailDismissMsg struct{}
 
+// The different ways to view the body of a mail.
+type bodyView int
+
+const (
+	textView bodyView = iota
+	htmlView
+	linksView
+)
+
+type copiedMsg struct {
+	what string
+	err  error
+}
+
 type Model struct {
+	account   accounts.Account
+	clipboard core.Clipboard
+
+	to      string
+	mail    models.Mail
+	message *backend.Message
+
+	headers     []backend.HeaderField
+	recipients  backend.Recipients
+	showHeaders bool
+
+	// All the links on the mail and the one currently selected.
+	links []string
+	link  int
+
+	view bodyView
+
+	status string
+
 	viewport viewport.Model
 
 	Width  int
@@ -31,11 +73,19 @@ type Model struct {
 	Colors   colors.ColorPalette
 }
 
-func NewModel(renderer *lipgloss.Renderer, colors colors.ColorPalette) Model {
+func NewModel(
+	account accounts.Account,
+	clipboard core.Clipboard,
+	renderer *lipgloss.Renderer,
+	colors colors.ColorPalette,
+) Model {
 	width := 64
 	height := 64
 
 	return Model{
+		account:   account,
+		clipboard: clipboard,
+
 		viewport: viewport.New(width, height),
 
 		Width:  width,
@@ -57,16 +107,95 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		m.viewport.Width = m.Width
 		m.viewport.Height = m.Height
 
+		// Rendered html depends on the width.
+		if m.message != nil {
+			m.render()
+		}
+
 	case tea.KeyMsg:
 		switch {
 		case key.Matches(msg, m.KeyMap.Dismiss):
 			return m, m.dismiss
+
+		case key.Matches(msg, m.KeyMap.CopyBody):
+			return m, m.copy("body", utils.Decode(m.mail.Text))
+
+		case key.Matches(msg, m.KeyMap.CopyCode):
+			return m, m.copy("code", m.mail.Code)
+
+		case key.Matches(msg, m.KeyMap.CopyLink):
+			return m, m.copy("link", m.links[m.link])
+
+		case key.Matches(msg, m.KeyMap.NextLink):
+			m.link = (m.link + 1) % len(m.links)
+			m.render()
+			return m, nil
+
+		case key.Matches(msg, m.KeyMap.PreviousLink):
+			m.link = (m.link + len(m.links) - 1) % len(m.links)
+			m.render()
+			return m, nil
+
+		case key.Matches(msg, m.KeyMap.NextView):
+			m.switchView(1)
+			return m, nil
+
+		case key.Matches(msg, m.KeyMap.PreviousView):
+			m.switchView(-1)
+			return m, nil
+
+		case key.Matches(msg, m.KeyMap.ToggleHeaders):
+			m.showHeaders = !m.showHeaders
+			if m.showHeaders {
+				m.KeyMap.ToggleHeaders.SetHelp("H", "hide headers")
+			} else {
+				m.KeyMap.ToggleHeaders.SetHelp("H", "show headers")
+			}
+			m.render()
+			return m, nil
+
+		case key.Matches(msg, m.KeyMap.Lint):
+			return m, m.lint
 		}
 
 	case MailSelectedMsg:
-		m.viewport.SetContent(m.makeContent(msg.To, msg.Mail))
+		m.to = msg.To
+		m.mail = msg.Mail
+		m.message = parseMessage(msg.Mail)
+		m.headers = backend.ParseHeaders(msg.Mail.Raw)
+		m.recipients = backend.ParseRecipients(m.message.Header)
+		m.links = findLinks(msg.Mail, m.message)
+		m.link = 0
+		for index, link := range m.links {
+			if link == msg.Mail.Link {
+				m.link = index
+			}
+		}
+		m.status = ""
+		m.view = textView
+
+		copying := m.clipboard != nil
+		m.KeyMap.CopyBody.SetEnabled(copying)
+		m.KeyMap.CopyCode.SetEnabled(copying && m.mail.Code != "")
+		m.KeyMap.CopyLink.SetEnabled(copying && len(m.links) > 0)
+		m.KeyMap.NextLink.SetEnabled(len(m.links) > 1)
+		m.KeyMap.PreviousLink.SetEnabled(len(m.links) > 1)
+		m.KeyMap.Lint.SetEnabled(m.message.HTML != "")
+		m.KeyMap.NextView.SetEnabled(len(m.views()) > 1)
+		m.KeyMap.PreviousView.SetEnabled(len(m.views()) > 1)
+
+		m.render()
 		m.viewport.SetYOffset(0)
 		return m, nil
+
+	case copiedMsg:
+		if msg.err != nil {
+			m.status = msg.err.Error()
+		} else {
+			m.status = fmt.Sprintf("copied the %s to the clipboard", msg.what)
+		}
+		m.render()
+		return m, nil
 	}
 
 	var cmd tea.Cmd
@@ -78,6 +207,38 @@ func (m Model) View() string {
 	return m.viewport.View()
 }
 
+// Returns the views available for the current mail.
+func (m Model) views() []bodyView {
+	views := []bodyView{textView}
+	if m.message != nil && m.message.HTML != "" {
+		views = append(views, htmlView)
+	}
+	if len(m.links) > 0 {
+		views = append(views, linksView)
+	}
+	return views
+}
+
+func (m *Model) switchView(direction int) {
+	views := m.views()
+	for index, view := range views {
+		if view == m.view {
+			m.view = views[(index+direction+len(views))%len(views)]
+			break
+		}
+	}
+
+	m.render()
+	m.viewport.SetYOffset(0)
+}
+
+// Renders the content of the mail while retaining the scroll position.
+func (m *Model) render() {
+	offset := m.viewport.YOffset
+	m.viewport.SetContent(m.makeContent(m.to, m.mail))
+	m.viewport.SetYOffset(offset)
+}
+
 func (m Model) makeContent(toAddress string, mail models.Mail) string {
 	labelStyle := m.Renderer.
 		NewStyle().
@@ -95,19 +256,47 @@ func (m Model) makeContent(toAddress string, mail models.Mail) string {
 	from = lipgloss.JoinHorizontal(
 		lipgloss.Left,
 		labelStyle.Render("From"),
-		valueStyle.Render(from),
+		valueStyle.Render(utils.StripControl(from)),
 	)
 
-	to := lipgloss.JoinHorizontal(
-		lipgloss.Left,
-		labelStyle.Render("To"),
-		valueStyle.Render(toAddress),
-	)
+	row := func(label string, value string) string {
+		return lipgloss.JoinHorizontal(
+			lipgloss.Left,
+			labelStyle.Render(label),
+			valueStyle.Render(utils.StripControl(value)),
+		)
+	}
+
+	// The recipients on the headers, these are not necessarily the address
+	// the mail was delivered to.
+	var recipients []string
+	if len(m.recipients.To) > 0 {
+		recipients = append(recipients, row("To", formatAddresses(m.recipients.To)))
+	}
+	if len(m.recipients.Cc) > 0 {
+		recipients = append(recipients, row("Cc", formatAddresses(m.recipients.Cc)))
+	}
+	if len(m.recipients.ReplyTo) > 0 {
+		recipients = append(recipients, row("Reply-To", formatAddresses(m.recipients.ReplyTo)))
+	}
+
+	envelope := mail.EnvelopeTo
+	if envelope == "" {
+		envelope = toAddress
+	}
+	delivered := row("Delivered To", envelope)
+	if len(recipients) > 0 && !m.recipients.Includes(envelope) {
+		delivered = lipgloss.JoinHorizontal(
+			lipgloss.Left,
+			delivered,
+			labelStyle.PaddingLeft(1).Render("(bcc)"),
+		)
+	}
 
 	subject := lipgloss.JoinHorizontal(
 		lipgloss.Left,
 		labelStyle.Render("Subject"),
-		valueStyle.Render(utils.Decode(mail.Subject)),
+		valueStyle.Render(utils.Decode(mail.DisplaySubject())),
 	)
 
 	created := lipgloss.JoinHorizontal(
@@ -116,36 +305,320 @@ func (m Model) makeContent(toAddress string, mail models.Mail) string {
 		valueStyle.Render(mail.CreatedAt.Format(time.RFC822)),
 	)
 
-	text := valueStyle.
+	parts := []string{from}
+	parts = append(parts, recipients...)
+	parts = append(parts, delivered, subject, created)
+	if tags := strings.Fields(mail.Tags); len(tags) > 0 {
+		parts = append(parts, row("Tags", strings.Join(tags, ", ")))
+	}
+	if m.showHeaders {
+		parts = append(parts, m.makeHeaders())
+	}
+	if extracted := m.makeExtracted(mail); extracted != "" {
+		parts = append(parts, extracted)
+	}
+	if views := m.views(); len(views) > 1 {
+		parts = append(parts, m.makeTabs(views))
+	}
+	parts = append(parts, m.makeBody(mail))
+
+	return lipgloss.JoinVertical(lipgloss.Top, parts...)
+}
+
+// Lists all the headers on the mail in the order they were received in.
+func (m Model) makeHeaders() string {
+	nameStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		PaddingRight(1)
+
+	valueStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Text)
+
+	lines := []string{nameStyle.Render("Headers")}
+	if len(m.headers) == 0 {
+		lines = append(lines, valueStyle.Render("the original message was not kept around for this mail"))
+	}
+	for _, header := range m.headers {
+		name := nameStyle.Render(header.Name + ":")
+		lines = append(lines, lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			name,
+			valueStyle.
+				Width(max(m.viewport.Width-lipgloss.Width(name)-4, 16)).
+				Render(utils.StripControl(header.Value)),
+		))
+	}
+
+	return m.Renderer.
+		NewStyle().
 		MarginTop(1).
-		Render(utils.Decode(mail.Text))
-
-	return lipgloss.JoinVertical(
-		lipgloss.Top,
-		to,
-		from,
-		subject,
-		created,
-		text,
-	)
+		Border(lipgloss.NormalBorder(), false, false, false, true).
+		BorderForeground(m.Colors.Muted).
+		PaddingLeft(1).
+		Render(lipgloss.JoinVertical(lipgloss.Top, lines...))
+}
+
+func formatAddresses(addresses []*mail.Address) string {
+	var formatted []string
+	for _, address := range addresses {
+		if address.Name != "" {
+			formatted = append(formatted, fmt.Sprintf("%s <%s>", address.Name, address.Address))
+		} else {
+			formatted = append(formatted, address.Address)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+func (m Model) makeTabs(views []bodyView) string {
+	activeStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Accent).
+		Bold(true).
+		PaddingRight(2)
+
+	inactiveStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		PaddingRight(2)
+
+	var tabs []string
+	for _, view := range views {
+		label := "Text"
+		switch view {
+		case htmlView:
+			label = "HTML"
+		case linksView:
+			label = fmt.Sprintf("Links %d", len(m.links))
+		}
+
+		if view == m.view {
+			tabs = append(tabs, activeStyle.Render(label))
+		} else {
+			tabs = append(tabs, inactiveStyle.Render(label))
+		}
+	}
+
+	return m.Renderer.
+		NewStyle().
+		MarginTop(1).
+		Render(lipgloss.JoinHorizontal(lipgloss.Left, tabs...))
+}
+
+func (m Model) makeBody(mail models.Mail) string {
+	style := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Text).
+		MarginTop(1)
+
+	switch m.view {
+	case htmlView:
+		return style.Render(renderHTML(m.message.HTML, m.viewport.Width, m.Renderer, m.Colors))
+
+	case linksView:
+		return style.Render(m.makeLinkIndex())
+	}
+
+	return style.Render(utils.Decode(mail.Text))
+}
+
+// Lists all the links on the mail, the selected link is marked.
+func (m Model) makeLinkIndex() string {
+	numberStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		Width(len(fmt.Sprint(len(m.links))) + 1).
+		Align(lipgloss.Right).
+		MarginRight(1)
+
+	markerStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Accent).
+		Width(2)
+
+	linkStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Text).
+		Underline(true)
+
+	var lines []string
+	for index, link := range m.links {
+		marker := ""
+		if index == m.link {
+			marker = "›"
+		}
+
+		lines = append(lines, lipgloss.JoinHorizontal(
+			lipgloss.Top,
+			numberStyle.Render(fmt.Sprint(index+1)),
+			markerStyle.Render(marker),
+			hyperlink(link, linkStyle.Render(utils.StripControl(link))),
+		))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Highlights the one-time code and the links on the mail, since, that is
+// usually what we are looking for.
+func (m Model) makeExtracted(mail models.Mail) string {
+	if mail.Code == "" && len(m.links) == 0 && m.status == "" {
+		return ""
+	}
+
+	labelStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		PaddingRight(1)
+
+	var lines []string
+	if mail.Code != "" {
+		lines = append(lines, lipgloss.JoinHorizontal(
+			lipgloss.Left,
+			labelStyle.Render("Code"),
+			m.Renderer.
+				NewStyle().
+				Foreground(m.Colors.Accent).
+				Bold(true).
+				Render(mail.Code),
+		))
+	}
+	if len(m.links) > 0 {
+		label := "Link"
+		if len(m.links) > 1 {
+			label = fmt.Sprintf("Link %d/%d", m.link+1, len(m.links))
+		}
+
+		lines = append(lines, lipgloss.JoinHorizontal(
+			lipgloss.Left,
+			labelStyle.Render(label),
+			m.Renderer.
+				NewStyle().
+				Foreground(m.Colors.Accent).
+				Render(m.links[m.link]),
+		))
+	}
+	if m.status != "" {
+		lines = append(lines, labelStyle.Render(m.status))
+	}
+
+	return m.Renderer.
+		NewStyle().
+		MarginTop(1).
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(m.Colors.Accent).
+		Padding(0, 1).
+		Render(lipgloss.JoinVertical(lipgloss.Top, lines...))
 }
 
 func (m Model) dismiss() tea.Msg {
 	return MailDismissMsg{}
 }
 
+// Puts the value on the clipboard of the account.
+func (m Model) copy(what string, value string) tea.Cmd {
+	return func() tea.Msg {
+		err := m.clipboard.Copy(context.Background(), m.account, []byte(value))
+		return copiedMsg{what: what, err: err}
+	}
+}
+
+// Builds the html report of the mail.
+func (m Model) lint() tea.Msg {
+	report, err := linter.LintMail(m.mail)
+	return lint.LintReportMsg{Mail: m.mail, Report: report, Err: err}
+}
+
+// Parses the original message on the mail. If it was not kept around, only
+// the plain text is available.
+func parseMessage(mail models.Mail) *backend.Message {
+	if message, err := backend.ParseMessage(mail.Raw); err == nil {
+		return message
+	}
+	return &backend.Message{Text: mail.Text, HTML: mail.HTML}
+}
+
+// Returns the links on the mail, the verification link always comes first.
+func findLinks(mail models.Mail, message *backend.Message) []string {
+	links := extract.Links(mail.Text, message.HTML)
+	if mail.Link == "" {
+		return links
+	}
+
+	ordered := []string{mail.Link}
+	for _, link := range links {
+		if link != mail.Link {
+			ordered = append(ordered, link)
+		}
+	}
+	return ordered
+}
+
 type KeyMap struct {
-	Dismiss key.Binding
+	CopyBody      key.Binding
+	CopyCode      key.Binding
+	CopyLink      key.Binding
+	NextLink      key.Binding
+	PreviousLink  key.Binding
+	NextView      key.Binding
+	PreviousView  key.Binding
+	ToggleHeaders key.Binding
+	Lint          key.Binding
+	Dismiss       key.Binding
 }
 
 func (m Model) Help() []key.Binding {
 	return []key.Binding{
+		m.KeyMap.NextView,
+		m.KeyMap.CopyCode,
+		m.KeyMap.CopyLink,
+		m.KeyMap.NextLink,
+		m.KeyMap.CopyBody,
+		m.KeyMap.ToggleHeaders,
+		m.KeyMap.Lint,
 		m.KeyMap.Dismiss,
 	}
 }
 
 func DefaultKeyMap() KeyMap {
 	return KeyMap{
+		CopyBody: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "copy body"),
+		),
+		CopyCode: key.NewBinding(
+			key.WithKeys("y"),
+			key.WithHelp("y", "copy code"),
+		),
+		CopyLink: key.NewBinding(
+			key.WithKeys("Y"),
+			key.WithHelp("Y", "copy link"),
+		),
+		NextLink: key.NewBinding(
+			key.WithKeys("]"),
+			key.WithHelp("[/]", "switch link"),
+		),
+		PreviousLink: key.NewBinding(
+			key.WithKeys("["),
+			key.WithHelp("[", "previous link"),
+		),
+		NextView: key.NewBinding(
+			key.WithKeys("tab"),
+			key.WithHelp("tab", "switch view"),
+		),
+		PreviousView: key.NewBinding(
+			key.WithKeys("shift+tab"),
+			key.WithHelp("shift+tab", "previous view"),
+		),
+		ToggleHeaders: key.NewBinding(
+			key.WithKeys("H"),
+			key.WithHelp("H", "show headers"),
+		),
+		Lint: key.NewBinding(
+			key.WithKeys("L"),
+			key.WithHelp("L", "lint html"),
+		),
 		Dismiss: key.NewBinding(
 			key.WithKeys("esc"),
 			key.WithHelp("esc", "go back"),
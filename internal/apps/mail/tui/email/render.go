@@ -0,0 +1,361 @@
+package email
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/lipgloss/table"
+	"github.com/ksdme/mail/internal/core/tui/colors"
+	"github.com/ksdme/mail/internal/utils"
+	"golang.org/x/net/html"
+)
+
+var whitespace = regexp.MustCompile(`\s+`)
+
+// Wraps the text in an OSC 8 hyperlink, terminals that support it make the
+// text clickable, the rest simply ignore the sequence. Urls with control
+// characters could end the sequence early, so, they are left as plain text.
+func hyperlink(url string, text string) string {
+	if url == "" || utils.StripControl(url) != url {
+		return text
+	}
+	return fmt.Sprintf("\x1b]8;;%s\x1b\\%s\x1b]8;;\x1b\\", url, text)
+}
+
+// Renders html into styled terminal text while keeping the structure of the
+// document, like headings, lists and tables, around. Since mails use tables
+// for their layout a lot, only tables with header cells are rendered as
+// tables, the rest are flattened.
+type htmlRenderer struct {
+	renderer *lipgloss.Renderer
+	colors   colors.ColorPalette
+}
+
+func renderHTML(
+	document string,
+	width int,
+	renderer *lipgloss.Renderer,
+	colors colors.ColorPalette,
+) string {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return fmt.Sprintf("could not render html: %v", err)
+	}
+
+	r := htmlRenderer{renderer: renderer, colors: colors}
+	return strings.Join(r.blocks(root, width), "\n\n")
+}
+
+// Renders the children of the node as a list of blocks.
+func (r htmlRenderer) blocks(node *html.Node, width int) []string {
+	var blocks []string
+	var inline strings.Builder
+
+	flush := func() {
+		text := strings.TrimSpace(whitespace.ReplaceAllString(inline.String(), " "))
+		inline.Reset()
+		if text != "" {
+			blocks = append(blocks, r.renderer.NewStyle().Width(width).Render(text))
+		}
+	}
+
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.Data == "br" {
+			flush()
+			continue
+		}
+		if !isBlock(child) {
+			inline.WriteString(r.inline(child))
+			continue
+		}
+
+		flush()
+		blocks = append(blocks, r.block(child, width)...)
+	}
+	flush()
+
+	return blocks
+}
+
+func (r htmlRenderer) block(node *html.Node, width int) []string {
+	switch node.Data {
+	case "head", "style", "script", "title", "meta", "link":
+		return nil
+
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		style := r.renderer.NewStyle().Bold(true).Width(width)
+		if node.Data == "h1" || node.Data == "h2" {
+			style = style.Foreground(r.colors.Accent)
+		}
+
+		text := strings.TrimSpace(whitespace.ReplaceAllString(r.inline(node), " "))
+		if text == "" {
+			return nil
+		}
+		return []string{style.Render(text)}
+
+	case "ul", "ol":
+		var items []string
+		index := 0
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode || child.Data != "li" {
+				continue
+			}
+			index += 1
+
+			bullet := "• "
+			if node.Data == "ol" {
+				bullet = fmt.Sprintf("%d. ", index)
+			}
+
+			content := strings.Join(r.blocks(child, width-len(bullet)), "\n")
+			items = append(items, lipgloss.JoinHorizontal(
+				lipgloss.Top,
+				r.renderer.NewStyle().Foreground(r.colors.Muted).Render(bullet),
+				content,
+			))
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return []string{strings.Join(items, "\n")}
+
+	case "blockquote":
+		content := strings.Join(r.blocks(node, width-2), "\n\n")
+		if content == "" {
+			return nil
+		}
+		return []string{
+			r.renderer.
+				NewStyle().
+				Border(lipgloss.NormalBorder(), false, false, false, true).
+				BorderForeground(r.colors.Muted).
+				PaddingLeft(1).
+				Render(content),
+		}
+
+	case "pre":
+		return []string{
+			r.renderer.
+				NewStyle().
+				Foreground(r.colors.Muted).
+				Render(strings.Trim(textContent(node), "\n")),
+		}
+
+	case "hr":
+		return []string{
+			r.renderer.
+				NewStyle().
+				Foreground(r.colors.Muted).
+				Render(strings.Repeat("─", max(width, 1))),
+		}
+
+	case "table":
+		if isDataTable(node) {
+			return []string{r.table(node, width)}
+		}
+	}
+
+	return r.blocks(node, width)
+}
+
+// Renders a table with header cells as a table.
+func (r htmlRenderer) table(node *html.Node, width int) string {
+	var headers []string
+	var rows [][]string
+
+	walk(node, func(row *html.Node) bool {
+		if row.Type != html.ElementNode || row.Data != "tr" {
+			return true
+		}
+
+		var cells []string
+		header := true
+		for cell := row.FirstChild; cell != nil; cell = cell.NextSibling {
+			if cell.Type != html.ElementNode || (cell.Data != "td" && cell.Data != "th") {
+				continue
+			}
+			if cell.Data == "td" {
+				header = false
+			}
+			cells = append(cells, strings.TrimSpace(whitespace.ReplaceAllString(r.inline(cell), " ")))
+		}
+
+		if header && headers == nil {
+			headers = cells
+		} else if len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+		return false
+	})
+
+	t := table.New().
+		Border(lipgloss.NormalBorder()).
+		BorderStyle(r.renderer.NewStyle().Foreground(r.colors.Muted)).
+		StyleFunc(func(row, col int) lipgloss.Style {
+			style := r.renderer.NewStyle().Padding(0, 1)
+			if row == 0 {
+				style = style.Bold(true)
+			}
+			return style
+		}).
+		Headers(headers...).
+		Rows(rows...)
+
+	// Only shrink the table when it doesn't fit, setting the width always
+	// stretches it otherwise.
+	rendered := t.Render()
+	if lipgloss.Width(rendered) > width {
+		rendered = t.Width(width).Render()
+	}
+	return rendered
+}
+
+// Renders the node as inline text, it is only wrapped later on.
+func (r htmlRenderer) inline(node *html.Node) string {
+	switch node.Type {
+	case html.TextNode:
+		// Styles are applied line by line, so, there shouldn't be any.
+		return whitespace.ReplaceAllString(utils.StripControl(node.Data), " ")
+
+	case html.ElementNode:
+		// Handled below.
+
+	default:
+		return ""
+	}
+
+	switch node.Data {
+	case "head", "style", "script", "title":
+		return ""
+
+	case "br":
+		return " "
+
+	case "img":
+		if alt := strings.TrimSpace(utils.StripControl(attribute(node, "alt"))); alt != "" {
+			return r.renderer.NewStyle().Foreground(r.colors.Muted).Render(fmt.Sprintf("[%s]", alt))
+		}
+		return ""
+	}
+
+	var b strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(r.inline(child))
+	}
+	text := b.String()
+	if strings.TrimSpace(text) == "" {
+		return text
+	}
+
+	switch node.Data {
+	case "a":
+		href := strings.TrimSpace(attribute(node, "href"))
+		if href == "" {
+			return text
+		}
+		style := r.renderer.NewStyle().Foreground(r.colors.Accent).Underline(true)
+		return restyle(text, func(text ...string) string {
+			return hyperlink(href, style.Render(text...))
+		})
+
+	case "b", "strong":
+		return restyle(text, r.renderer.NewStyle().Bold(true).Render)
+
+	case "i", "em":
+		return restyle(text, r.renderer.NewStyle().Italic(true).Render)
+
+	case "code":
+		return restyle(text, r.renderer.NewStyle().Foreground(r.colors.Muted).Render)
+	}
+
+	// Block elements that are nested in inline elements end up here.
+	if isBlock(node) {
+		return " " + text + " "
+	}
+	return text
+}
+
+// Applies the style on the text while leaving the surrounding whitespace out.
+func restyle(text string, style func(...string) string) string {
+	trimmed := strings.TrimSpace(text)
+	start := strings.Index(text, trimmed)
+	return text[:start] + style(trimmed) + text[start+len(trimmed):]
+}
+
+func isBlock(node *html.Node) bool {
+	if node.Type == html.DocumentNode {
+		return true
+	}
+	if node.Type != html.ElementNode {
+		return false
+	}
+
+	switch node.Data {
+	case "html", "head", "body", "style", "script", "title", "meta", "link",
+		"p", "div", "section", "article", "header", "footer", "main", "nav",
+		"aside", "center", "address", "figure", "figcaption",
+		"h1", "h2", "h3", "h4", "h5", "h6",
+		"ul", "ol", "li", "dl", "dt", "dd",
+		"blockquote", "pre", "hr",
+		"table", "thead", "tbody", "tfoot", "tr", "td", "th", "caption":
+		return true
+	}
+	return false
+}
+
+// Tables with header cells that don't nest other tables are likely to carry
+// data rather than being a part of the layout.
+func isDataTable(node *html.Node) bool {
+	headers := false
+	nested := false
+	walk(node, func(child *html.Node) bool {
+		if child == node {
+			return true
+		}
+		if child.Type == html.ElementNode {
+			switch child.Data {
+			case "th":
+				headers = true
+			case "table":
+				nested = true
+				return false
+			}
+		}
+		return true
+	})
+	return headers && !nested
+}
+
+func textContent(node *html.Node) string {
+	var b strings.Builder
+	walk(node, func(child *html.Node) bool {
+		if child.Type == html.TextNode {
+			b.WriteString(child.Data)
+		}
+		return true
+	})
+	return b.String()
+}
+
+func attribute(node *html.Node, name string) string {
+	for _, attr := range node.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val
+		}
+	}
+	return ""
+}
+
+// Visits the node and its descendants, the children of a node are skipped
+// when the visitor returns false.
+func walk(node *html.Node, visit func(*html.Node) bool) {
+	if !visit(node) {
+		return
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		walk(child, visit)
+	}
+}
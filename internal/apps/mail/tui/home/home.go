@@ -8,13 +8,17 @@ import (
 	"time"
 
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
 	"github.com/ksdme/mail/internal/apps/mail/events"
 	"github.com/ksdme/mail/internal/apps/mail/models"
 	"github.com/ksdme/mail/internal/apps/mail/tui/email"
+	"github.com/ksdme/mail/internal/apps/mail/tui/leaks"
+	"github.com/ksdme/mail/internal/apps/mail/tui/senders"
 	"github.com/ksdme/mail/internal/core/tui/colors"
+	"github.com/ksdme/mail/internal/core/tui/components/confirm"
 	"github.com/ksdme/mail/internal/core/tui/components/picker"
 	"github.com/ksdme/mail/internal/core/tui/components/table"
 	"github.com/ksdme/mail/internal/utils"
@@ -37,9 +41,42 @@ type mailboxesRefreshedMsg struct {
 }
 
 type mailsRefreshedMsg struct {
-	mailbox *mailboxWithUnread
-	mails   []models.Mail
-	err     error
+	mailbox   *mailboxWithUnread
+	mails     []models.Mail
+	retention time.Duration
+	err       error
+}
+
+// Sent once mails or a mailbox are moved to the trash, they can be brought
+// back for a short while after.
+type trashedMsg struct {
+	message string
+	restore tea.Cmd
+	next    tea.Cmd
+}
+
+type domainPickedMsg struct {
+	domain string
+}
+
+type undoExpiredMsg struct {
+	id int
+}
+
+type undo struct {
+	id      int
+	message string
+	restore tea.Cmd
+}
+
+// How long the last delete can be undone for from the tui, it can still be
+// restored from the trash after that.
+const undoWindow = 10 * time.Second
+
+type searchResultsMsg struct {
+	query string
+	mails []models.Mail
+	err   error
 }
 
 type Model struct {
@@ -49,6 +86,23 @@ type Model struct {
 	mailboxes picker.Model
 	mailbox   *mailboxWithUnread
 	mails     table.Model
+	retention time.Duration
+
+	// The domain new mailboxes are generated on, the mx host by default.
+	domain string
+
+	// The mails on the table are grouped into threads, only the latest mail
+	// on a thread is shown unless it is expanded.
+	list     []models.Mail
+	expanded map[int64]bool
+
+	// When a query is active, the mails table shows the search results
+	// from across all the mailboxes instead.
+	search    textinput.Model
+	searching bool
+	query     string
+
+	undo *undo
 
 	Width  int
 	Height int
@@ -58,7 +112,12 @@ type Model struct {
 	Colors   colors.ColorPalette
 }
 
-func NewModel(db *bun.DB, renderer *lipgloss.Renderer, colors colors.ColorPalette) Model {
+func NewModel(
+	db *bun.DB,
+	account accounts.Account,
+	renderer *lipgloss.Renderer,
+	colors colors.ColorPalette,
+) Model {
 	width := 80
 	height := 80
 
@@ -78,6 +137,7 @@ func NewModel(db *bun.DB, renderer *lipgloss.Renderer, colors colors.ColorPalett
 	tStyles.Header = renderer.NewStyle().Height(2).Foreground(colors.Muted).PaddingLeft(1)
 	tStyles.Selected = tStyles.Selected.Foreground(colors.Accent).Bold(true)
 	tStyles.Cell = tStyles.Cell.PaddingLeft(1)
+	tStyles.Marked = tStyles.Cell.Reverse(true)
 	table := table.New(
 		table.WithColumns(makeMailTableColumns(width*2/3)),
 		table.WithHeight(height),
@@ -85,11 +145,23 @@ func NewModel(db *bun.DB, renderer *lipgloss.Renderer, colors colors.ColorPalett
 		table.WithStyles(tStyles),
 	)
 
+	// Setup the search input.
+	search := textinput.New()
+	search.Prompt = "/ "
+	search.Placeholder = "search subject, sender and body"
+	search.PromptStyle = renderer.NewStyle().Foreground(colors.Accent)
+	search.TextStyle = renderer.NewStyle().Foreground(colors.Text)
+	search.PlaceholderStyle = renderer.NewStyle().Foreground(colors.Muted)
+	search.Cursor.Style = renderer.NewStyle().Foreground(colors.Accent)
+
 	return Model{
-		db: db,
+		db:      db,
+		account: account,
 
 		mailboxes: mailboxes,
 		mails:     table,
+		expanded:  make(map[int64]bool),
+		search:    search,
 
 		Width:  width,
 		Height: height,
@@ -116,11 +188,67 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 		m.mailboxes.Height = m.Height
 
 		m.mails.SetWidth(m.Width - m.mailboxes.Width - gap)
-		m.mails.SetHeight(m.Height)
 		m.mails.SetColumns(makeMailTableColumns(m.mails.Width()))
+		m.search.Width = m.mails.Width() - 3
+		m.resizeMails()
 
 	case tea.KeyMsg:
+		// The search input takes over all the keys while it is active.
+		if m.searching {
+			switch {
+			case key.Matches(msg, m.KeyMap.SubmitSearch):
+				m.searching = false
+				m.search.Blur()
+				m.query = m.search.Value()
+				if m.query == "" {
+					m.resizeMails()
+					m.mails.SetRows([]table.Row{})
+					if m.mailbox != nil {
+						return m, m.refreshMails(m.mailbox)
+					}
+					return m, nil
+				}
+				return m, m.searchMails(m.query)
+
+			case key.Matches(msg, m.KeyMap.CancelSearch):
+				m.searching = false
+				m.search.Blur()
+				m.search.SetValue(m.query)
+				m.resizeMails()
+				return m, nil
+			}
+
+			var cmd tea.Cmd
+			m.search, cmd = m.search.Update(msg)
+			return m, cmd
+		}
+
 		switch {
+		case key.Matches(msg, m.KeyMap.Undo) && m.undo != nil:
+			restore := m.undo.restore
+			m.undo = nil
+			m.resizeMails()
+			return m, restore
+
+		case key.Matches(msg, m.KeyMap.Search):
+			m.searching = true
+			m.resizeMails()
+			return m, m.search.Focus()
+
+		case key.Matches(msg, m.KeyMap.CancelSearch) && m.query != "":
+			m.query = ""
+			m.search.SetValue("")
+			m.resizeMails()
+			m.mails.SetRows([]table.Row{})
+			if m.mailbox != nil {
+				return m, m.refreshMails(m.mailbox)
+			}
+			return m, nil
+
+		case key.Matches(msg, m.KeyMap.ClearMarked) && m.mails.HasMarked():
+			m.mails.ClearMarked()
+			return m, nil
+
 		case key.Matches(msg, m.KeyMap.FocusMailboxes):
 			m.mailboxes.Focus()
 			m.mails.Blur()
@@ -136,6 +264,10 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 				if item := m.mailboxes.Select(); item != nil {
 					m.mailbox = item.(*mailboxItem).mailbox
 
+					m.query = ""
+					m.search.SetValue("")
+					m.resizeMails()
+
 					m.mails.SetRows([]table.Row{})
 					m.mailboxes.Blur()
 					m.mails.Focus()
@@ -145,27 +277,137 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 			} else if m.mails.Focused() {
 				if row, err := m.mails.SelectedRow(); err == nil {
 					mail := row.Value.(models.Mail)
+
+					// Search results can be from any of the mailboxes.
+					mailbox := m.mailbox.Mailbox
+					if mail.Mailbox != nil {
+						mailbox = *mail.Mailbox
+					}
+
 					return m, tea.Batch(
-						m.mailSelected(m.mailbox, mail),
-						m.markMailSeen(mail),
+						m.mailSelected(mailbox, mail),
+						m.markMailSeen(mailbox, mail),
 					)
 				}
 			}
 
+		case key.Matches(msg, m.KeyMap.TogglePin):
+			if m.mails.Focused() {
+				if mails := m.targetMails(); len(mails) > 0 {
+					m.mails.ClearMarked()
+					return m, m.togglePin(mails)
+				}
+			}
+
+		case key.Matches(msg, m.KeyMap.ToggleSeen):
+			if m.mails.Focused() {
+				if mails := m.targetMails(); len(mails) > 0 {
+					m.mails.ClearMarked()
+					return m, m.toggleSeen(mails)
+				}
+			}
+
+		case key.Matches(msg, m.KeyMap.DeleteMails):
+			if m.mails.Focused() {
+				if mails := m.targetMails(); len(mails) > 0 {
+					message := "The mail will be moved to the trash."
+					if len(mails) > 1 {
+						message = fmt.Sprintf("The %d mails will be moved to the trash.", len(mails))
+					}
+					return m, confirm.Ask("Delete mails?", message, "Delete", m.deleteMails(mails))
+				}
+			}
+
+		case key.Matches(msg, m.KeyMap.ToggleMarked):
+			if m.mails.Focused() {
+				m.mails.ToggleMarked()
+				m.mails.MoveDown(1)
+			}
+
+		case key.Matches(msg, m.KeyMap.ToggleMarkedAll):
+			if m.mails.Focused() {
+				m.mails.ToggleMarkedAll()
+			}
+
+		case key.Matches(msg, m.KeyMap.ToggleThread):
+			if m.mails.Focused() && m.query == "" {
+				if row, err := m.mails.SelectedRow(); err == nil {
+					thread := row.Value.(models.Mail).Thread()
+					if m.expanded[thread] {
+						delete(m.expanded, thread)
+
+						// Keep the cursor on the thread when collapsing it.
+						m.setMails(m.list)
+						for index, row := range m.mails.Rows() {
+							if row.Value.(models.Mail).Thread() == thread {
+								m.mails.SetCursor(index)
+								break
+							}
+						}
+					} else {
+						m.expanded[thread] = true
+						m.setMails(m.list)
+					}
+				}
+			}
+
 		case key.Matches(msg, m.KeyMap.CreateRandomMailbox):
 			return m, m.createRandomMailbox
 
+		case key.Matches(msg, m.KeyMap.PickDomain):
+			return m, m.pickNextDomain
+
 		case key.Matches(msg, m.KeyMap.DeleteMailbox):
 			if item := m.mailboxes.HighlightedItem(); item != nil {
 				mailbox := item.(*mailboxItem).mailbox
-				return m, m.deleteMailbox(mailbox)
+				return m, confirm.Ask(
+					"Delete mailbox?",
+					fmt.Sprintf("%s and all the mails on it will be moved to the trash.", mailbox.Email()),
+					"Delete",
+					m.deleteMailbox(mailbox),
+				)
+			}
+
+		case key.Matches(msg, m.KeyMap.ShowLeaks):
+			return m, m.showLeaks
+
+		case key.Matches(msg, m.KeyMap.ShowSenders):
+			if item := m.mailboxes.HighlightedItem(); item != nil {
+				return m, m.showSenders(item.(*mailboxItem).mailbox.Mailbox)
+			}
+
+		case key.Matches(msg, m.KeyMap.BlockSender):
+			if m.mails.Focused() {
+				if row, err := m.mails.SelectedRow(); err == nil {
+					mail := row.Value.(models.Mail)
+
+					// Search results can be from any of the mailboxes.
+					mailbox := m.mailbox.Mailbox
+					if mail.Mailbox != nil {
+						mailbox = *mail.Mailbox
+					}
+
+					return m, confirm.Ask(
+						"Block sender?",
+						fmt.Sprintf("Mails from %s will be rejected on %s.", mail.FromAddress, mailbox.Email()),
+						"Block",
+						m.blockSender(mailbox, mail.FromAddress),
+					)
+				}
 			}
 		}
 
 	case MailboxRealTimeUpdate:
 		// TODO: Maybe don't refresh if the home view is not active.
 		slog.Debug("received mailbox update", "mailbox", msg.mailbox)
-		if msg.mailbox == m.mailbox.ID {
+		if m.query != "" {
+			return m, tea.Batch(
+				m.searchMails(m.query),
+				m.refreshMailboxes(true),
+				m.listenToMailboxUpdate,
+			)
+		}
+		if m.mailbox != nil && msg.mailbox == m.mailbox.ID {
 			return m, tea.Batch(
 				// TODO: Debounce these loads.
 				m.refreshMails(m.mailbox),
@@ -179,6 +421,11 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 			m.listenToMailboxUpdate,
 		)
 
+	case domainPickedMsg:
+		m.domain = msg.domain
+		m.KeyMap.CreateRandomMailbox.SetHelp("ctrl+n", fmt.Sprintf("generate mailbox on %s", msg.domain))
+		return m, nil
+
 	case mailboxesRefreshedMsg:
 		// TODO: Handle error.
 		var items []picker.Item
@@ -203,31 +450,44 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 
 	case mailsRefreshedMsg:
 		// TODO: Handle error.
-		if msg.mailbox.ID == m.mailbox.ID {
-			var items []table.Row
-			for _, mail := range msg.mails {
-				age := fmt.Sprintf(
-					"%s ago",
-					utils.RoundedAge(time.Since(mail.CreatedAt)),
-				)
+		if m.query == "" && m.mailbox != nil && msg.mailbox.ID == m.mailbox.ID {
+			m.retention = msg.retention
+			m.setMails(msg.mails)
+		}
+		return m, nil
 
-				items = append(items, table.Row{
-					ID:    int(mail.ID),
-					Value: mail,
-					Cols:  []string{mail.Subject, mail.FromAddress, age},
-				})
-			}
-			m.mails.SetRows(items)
+	case trashedMsg:
+		id := 1
+		if m.undo != nil {
+			id = m.undo.id + 1
+		}
+		m.undo = &undo{id: id, message: msg.message, restore: msg.restore}
+		m.resizeMails()
+
+		expire := tea.Tick(undoWindow, func(time.Time) tea.Msg {
+			return undoExpiredMsg{id}
+		})
+		return m, tea.Batch(msg.next, expire)
+
+	case undoExpiredMsg:
+		if m.undo != nil && m.undo.id == msg.id {
+			m.undo = nil
+			m.resizeMails()
+		}
+		return m, nil
 
-			// If the update caused there to be no mails.
-			if !m.mails.HasRows() {
-				m.mails.Blur()
-				m.mailboxes.Focus()
+	case searchResultsMsg:
+		if msg.err != nil {
+			slog.Error("could not search mails", "err", msg.err)
+		}
+		if msg.query == m.query {
+			m.setMails(msg.mails)
+			if m.mails.HasRows() {
+				m.mailboxes.Blur()
+				m.mails.Focus()
 			}
-			return m, nil
-		} else {
-			return m, nil
 		}
+		return m, nil
 	}
 
 	var cmd tea.Cmd
@@ -240,6 +500,11 @@ func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
 	}
 }
 
+// Returns a boolean indicating if a search query is being typed in.
+func (m Model) Editing() bool {
+	return m.searching
+}
+
 func (m Model) View() string {
 	if !m.mailboxes.HasItems() {
 		return m.Renderer.
@@ -259,7 +524,22 @@ func (m Model) View() string {
 		Render(m.mailboxes.View())
 
 	var mails string
-	if !m.mails.HasRows() {
+	if !m.mails.HasRows() && m.query != "" {
+		mails = lipgloss.JoinVertical(
+			lipgloss.Top,
+			m.mailboxes.
+				Styles.
+				Title.
+				PaddingLeft(0).
+				Render("Mails"),
+			m.Renderer.
+				NewStyle().
+				Width(m.mails.Width()).
+				Height(m.mails.Height()).
+				Foreground(m.Colors.Text).
+				Render(fmt.Sprintf("no mails matching %q", m.query)),
+		)
+	} else if !m.mails.HasRows() {
 		mails = lipgloss.JoinVertical(
 			lipgloss.Top,
 			m.mailboxes.
@@ -273,14 +553,36 @@ func (m Model) View() string {
 				Height(m.mails.Height()).
 				Foreground(m.Colors.Text).
 				Render(fmt.Sprintf(
-					"no mails in %s, incoming mails are only stored for 48h",
+					"no mails in %s, incoming mails are only stored for %s",
 					m.mailbox.Email(),
+					m.retention.String(),
 				)),
 		)
 	} else {
 		mails = m.mails.View()
 	}
 
+	if m.searching || m.query != "" {
+		mails = lipgloss.JoinVertical(
+			lipgloss.Top,
+			m.Renderer.NewStyle().PaddingLeft(1).PaddingBottom(1).Render(m.search.View()),
+			mails,
+		)
+	}
+
+	if m.undo != nil {
+		mails = lipgloss.JoinVertical(
+			lipgloss.Top,
+			m.Renderer.
+				NewStyle().
+				PaddingLeft(1).
+				PaddingBottom(1).
+				Foreground(m.Colors.Accent).
+				Render(m.undo.message),
+			mails,
+		)
+	}
+
 	return lipgloss.JoinHorizontal(
 		lipgloss.Left,
 		mailboxes,
@@ -301,6 +603,7 @@ func (m Model) refreshMailboxes(passive bool) tea.Cmd {
 			Join("LEFT JOIN mails AS mail").
 			JoinOn("mail.mailbox_id = mailbox.id").
 			JoinOn("mail.seen = false").
+			JoinOn("mail.deleted_at IS NULL").
 			Order("mailbox.id DESC").
 			Group("mailbox.id").
 			Scan(context.TODO(), &mailboxes)
@@ -323,16 +626,121 @@ func (m Model) refreshMails(mailbox *mailboxWithUnread) tea.Cmd {
 			Order("id DESC").
 			Scan(context.TODO())
 
+		retention := mailbox.EffectiveRetention(nil)
+		if settings, err := models.GetSettings(context.TODO(), m.db, m.account); err == nil {
+			retention = mailbox.EffectiveRetention(settings)
+		}
+
 		return mailsRefreshedMsg{
-			mailbox: mailbox,
-			mails:   mails,
-			err:     err,
+			mailbox:   mailbox,
+			mails:     mails,
+			retention: retention,
+			err:       err,
+		}
+	}
+}
+
+func (m Model) searchMails(query string) tea.Cmd {
+	return func() tea.Msg {
+		mails, err := models.SearchMails(context.TODO(), m.db, m.account, query, 100)
+		return searchResultsMsg{
+			query: query,
+			mails: mails,
+			err:   err,
+		}
+	}
+}
+
+// Populates the mails table. Mails on a mailbox are grouped into threads,
+// search results are listed as they are.
+func (m *Model) setMails(mails []models.Mail) {
+	m.list = mails
+
+	var items []table.Row
+	if m.query != "" {
+		for _, mail := range mails {
+			items = append(items, makeMailRow(mail, "", !mail.Seen))
 		}
+	} else {
+		// The mails are sorted newest first, so, the threads end up being
+		// sorted by their latest mail too.
+		var threads []int64
+		grouped := make(map[int64][]models.Mail)
+		for _, mail := range mails {
+			thread := mail.Thread()
+			if _, ok := grouped[thread]; !ok {
+				threads = append(threads, thread)
+			}
+			grouped[thread] = append(grouped[thread], mail)
+		}
+
+		for _, thread := range threads {
+			mails := grouped[thread]
+			if len(mails) == 1 {
+				items = append(items, makeMailRow(mails[0], "", !mails[0].Seen))
+				continue
+			}
+
+			if !m.expanded[thread] {
+				// Collapsed threads are unread if any of their mails are.
+				unread := false
+				for _, mail := range mails {
+					unread = unread || !mail.Seen
+				}
+				items = append(items, makeMailRow(mails[0], fmt.Sprintf("▸ %d ", len(mails)), unread))
+				continue
+			}
+
+			items = append(items, makeMailRow(mails[0], fmt.Sprintf("▾ %d ", len(mails)), !mails[0].Seen))
+			for _, mail := range mails[1:] {
+				items = append(items, makeMailRow(mail, "  └ ", !mail.Seen))
+			}
+		}
+	}
+	m.mails.SetRows(items)
+
+	// If the update caused there to be no mails.
+	if !m.mails.HasRows() {
+		m.mails.Blur()
+		m.mailboxes.Focus()
+	}
+}
+
+func makeMailRow(mail models.Mail, prefix string, unread bool) table.Row {
+	age := fmt.Sprintf(
+		"%s ago",
+		utils.RoundedAge(time.Since(mail.CreatedAt)),
+	)
+
+	subject := mail.DisplaySubject()
+	if mail.Important {
+		subject = "★ " + subject
+	}
+	if unread {
+		subject = "• " + subject
+	}
+
+	return table.Row{
+		ID:    int(mail.ID),
+		Value: mail,
+		Cols:  []string{prefix + subject, mail.FromAddress, age},
+	}
+}
+
+// Makes room for the search bar when it is visible.
+func (m *Model) resizeMails() {
+	height := m.Height
+	if m.searching || m.query != "" {
+		height -= 2
+	}
+	if m.undo != nil {
+		height -= 2
 	}
+	m.mails.SetHeight(height)
 }
 
 func (m Model) createRandomMailbox() tea.Msg {
-	_, err := models.CreateRandomMailbox(context.TODO(), m.db, m.account)
+	_, err := models.CreateRandomMailbox(context.TODO(), m.db, m.account, m.domain)
 	if err != nil {
 		// TODO: Handle this error.
 		slog.Error("could not create mailbox", "err", err)
@@ -342,29 +750,46 @@ func (m Model) createRandomMailbox() tea.Msg {
 	return m.refreshMailboxes(false)()
 }
 
+// Moves on to the next domain mailboxes can be generated on.
+func (m Model) pickNextDomain() tea.Msg {
+	domains, err := models.ListMailboxDomains(context.TODO(), m.db, m.account)
+	if err != nil {
+		slog.Error("could not list domains", "err", err)
+		return nil
+	}
+
+	current := m.domain
+	if current == "" {
+		current = domains[0]
+	}
+
+	next := domains[0]
+	for index, domain := range domains {
+		if domain == current && index+1 < len(domains) {
+			next = domains[index+1]
+		}
+	}
+	return domainPickedMsg{domain: next}
+}
+
 func (m Model) deleteMailbox(mailbox *mailboxWithUnread) tea.Cmd {
 	return func() tea.Msg {
-		_, err := m.db.
-			NewDelete().
-			Model(&models.Mailbox{}).
-			Where("id = ?", mailbox.ID).
-			Exec(context.TODO())
-		if err != nil {
+		if err := mailbox.Delete(context.TODO(), m.db); err != nil {
 			slog.Error("could not delete mailbox", "mailbox", mailbox.ID, "err", err)
 			return nil
 		}
 
-		_, err = m.db.
-			NewDelete().
-			Model(&models.Mail{}).
-			Where("mailbox_id = ?", mailbox.ID).
-			Exec(context.TODO())
-		if err != nil {
-			slog.Error("could not delete mails", "mailbox", mailbox.ID, "err", err)
-			return nil
+		return trashedMsg{
+			message: fmt.Sprintf("Moved %s to the trash", mailbox.Email()),
+			restore: func() tea.Msg {
+				if err := mailbox.Restore(context.TODO(), m.db); err != nil {
+					slog.Error("could not restore mailbox", "mailbox", mailbox.ID, "err", err)
+					return nil
+				}
+				return m.refreshMailboxes(true)()
+			},
+			next: m.refreshMailboxes(false),
 		}
-
-		return m.refreshMailboxes(false)()
 	}
 }
 
@@ -377,39 +802,183 @@ func (m Model) listenToMailboxUpdate() tea.Msg {
 	return nil
 }
 
-func (m Model) markMailSeen(mail models.Mail) tea.Cmd {
+func (m Model) markMailSeen(mailbox models.Mailbox, mail models.Mail) tea.Cmd {
 	return func() tea.Msg {
 		if !mail.Seen {
-			mail.Seen = true
-
-			_, err := m.db.NewUpdate().Model(&mail).WherePK().Exec(context.TODO())
+			burned, err := mail.MarkSeen(context.TODO(), m.db, mailbox)
 			if err != nil {
 				slog.Error("could not mark email read", "mail", mail.ID, "err", err)
+				return nil
 			}
 
 			if m.mailbox != nil && mail.MailboxID == m.mailbox.ID {
 				m.mailbox.Unread -= 1
 			}
+
+			if burned {
+				events.MailboxContentsUpdatedSignal.Emit(m.account.ID, mailbox.ID)
+			}
+		}
+
+		return nil
+	}
+}
+
+// Returns the mails that the actions apply to, which are the marked mails,
+// or, the mail under the cursor. Collapsed threads stand for all their mails.
+func (m Model) targetMails() []models.Mail {
+	rows := m.mails.MarkedRows()
+	if len(rows) == 0 {
+		if row, err := m.mails.SelectedRow(); err == nil {
+			rows = append(rows, row)
+		}
+	}
+
+	var mails []models.Mail
+	for _, row := range rows {
+		mail := row.Value.(models.Mail)
+		if m.query != "" || m.expanded[mail.Thread()] {
+			mails = append(mails, mail)
+			continue
+		}
+
+		for _, other := range m.list {
+			if other.Thread() == mail.Thread() {
+				mails = append(mails, other)
+			}
 		}
+	}
+	return mails
+}
+
+// Stars the mails, or, unstars them if all of them are already starred.
+func (m Model) togglePin(mails []models.Mail) tea.Cmd {
+	important := false
+	for _, mail := range mails {
+		important = important || !mail.Important
+	}
+
+	return func() tea.Msg {
+		m.updateMails(mails, func(ctx context.Context, ids []int64) error {
+			return models.SetMailsImportant(ctx, m.db, ids, important)
+		})
+		return nil
+	}
+}
+
+// Marks the mails as read, or, unread if all of them are already read.
+func (m Model) toggleSeen(mails []models.Mail) tea.Cmd {
+	seen := false
+	for _, mail := range mails {
+		seen = seen || !mail.Seen
+	}
 
+	return func() tea.Msg {
+		m.updateMails(mails, func(ctx context.Context, ids []int64) error {
+			return models.SetMailsSeen(ctx, m.db, ids, seen)
+		})
 		return nil
 	}
 }
 
-func (m Model) mailSelected(mailbox *mailboxWithUnread, mail models.Mail) tea.Cmd {
+// Moves the mails to the trash.
+func (m Model) deleteMails(mails []models.Mail) tea.Cmd {
+	return func() tea.Msg {
+		ok := m.updateMails(mails, func(ctx context.Context, ids []int64) error {
+			return models.DeleteMails(ctx, m.db, ids)
+		})
+		if !ok {
+			return nil
+		}
+
+		message := "Moved the mail to the trash"
+		if len(mails) > 1 {
+			message = fmt.Sprintf("Moved %d mails to the trash", len(mails))
+		}
+		return trashedMsg{
+			message: message,
+			restore: func() tea.Msg {
+				m.updateMails(mails, func(ctx context.Context, ids []int64) error {
+					return models.RestoreMails(ctx, m.db, ids)
+				})
+				return nil
+			},
+		}
+	}
+}
+
+// Applies the update on the mails and lets the mailboxes they are on know.
+// Returns a boolean indicating if the update went through.
+func (m Model) updateMails(
+	mails []models.Mail,
+	update func(ctx context.Context, ids []int64) error,
+) bool {
+	var ids []int64
+	mailboxes := make(map[int64]bool)
+	for _, mail := range mails {
+		ids = append(ids, mail.ID)
+		mailboxes[mail.MailboxID] = true
+	}
+
+	if err := update(context.TODO(), ids); err != nil {
+		slog.Error("could not update mails", "mails", ids, "err", err)
+		return false
+	}
+
+	for mailbox := range mailboxes {
+		events.MailboxContentsUpdatedSignal.Emit(m.account.ID, mailbox)
+	}
+	return true
+}
+
+func (m Model) mailSelected(mailbox models.Mailbox, mail models.Mail) tea.Cmd {
 	return func() tea.Msg {
 		return email.MailSelectedMsg{To: mailbox.Email(), Mail: mail}
 	}
 }
 
+func (m Model) showLeaks() tea.Msg {
+	found, err := models.FindLeaks(context.TODO(), m.db, m.account)
+	return leaks.LeaksReportMsg{Leaks: found, Err: err}
+}
+
+func (m Model) showSenders(mailbox models.Mailbox) tea.Cmd {
+	return func() tea.Msg {
+		filters, err := models.ListSenderFilters(context.TODO(), m.db, mailbox)
+		return senders.SendersReportMsg{Mailbox: mailbox, Filters: filters, Err: err}
+	}
+}
+
+func (m Model) blockSender(mailbox models.Mailbox, sender string) tea.Cmd {
+	return func() tea.Msg {
+		_, err := models.CreateSenderFilter(context.TODO(), m.db, mailbox, sender, false)
+		if err != nil {
+			slog.Error("could not block sender", "mailbox", mailbox.ID, "err", err)
+		}
+		return nil
+	}
+}
+
 func (m Model) Help() []key.Binding {
 	var help []key.Binding
 
+	if m.searching {
+		return append(help, m.KeyMap.SubmitSearch, m.KeyMap.CancelSearch)
+	}
+
+	if m.undo != nil {
+		help = append(help, m.KeyMap.Undo)
+	}
+
 	if m.mailboxes.IsFocused() {
 		help = append(
 			help,
 			m.KeyMap.CreateRandomMailbox,
+			m.KeyMap.PickDomain,
 			m.KeyMap.DeleteMailbox,
+			m.KeyMap.ShowLeaks,
+			m.KeyMap.ShowSenders,
+			m.KeyMap.Search,
 			m.KeyMap.Select,
 			m.KeyMap.FocusMails,
 		)
@@ -417,8 +986,22 @@ func (m Model) Help() []key.Binding {
 		help = append(
 			help,
 			m.KeyMap.Select,
-			m.KeyMap.FocusMailboxes,
+			m.KeyMap.TogglePin,
+			m.KeyMap.ToggleSeen,
+			m.KeyMap.DeleteMails,
+			m.KeyMap.BlockSender,
+			m.KeyMap.ToggleMarked,
+			m.KeyMap.ToggleMarkedAll,
 		)
+		if m.query == "" {
+			help = append(help, m.KeyMap.ToggleThread)
+		}
+		help = append(help, m.KeyMap.Search)
+		if m.mails.HasMarked() {
+			help = append(help, m.KeyMap.ClearMarked)
+		} else {
+			help = append(help, m.KeyMap.FocusMailboxes)
+		}
 	}
 
 	return help
@@ -426,9 +1009,27 @@ func (m Model) Help() []key.Binding {
 
 type KeyMap struct {
 	CreateRandomMailbox key.Binding
+	PickDomain          key.Binding
 	DeleteMailbox       key.Binding
+	ShowLeaks           key.Binding
+	ShowSenders         key.Binding
+
+	Select       key.Binding
+	TogglePin    key.Binding
+	ToggleSeen   key.Binding
+	DeleteMails  key.Binding
+	BlockSender  key.Binding
+	ToggleThread key.Binding
+
+	Undo key.Binding
 
-	Select key.Binding
+	ToggleMarked    key.Binding
+	ToggleMarkedAll key.Binding
+	ClearMarked     key.Binding
+
+	Search       key.Binding
+	SubmitSearch key.Binding
+	CancelSearch key.Binding
 
 	FocusMailboxes key.Binding
 	FocusMails     key.Binding
@@ -440,15 +1041,78 @@ func DefaultKeyMap() KeyMap {
 			key.WithKeys("ctrl+n"),
 			key.WithHelp("ctrl+n", "generate mailbox"),
 		),
+		PickDomain: key.NewBinding(
+			key.WithKeys("ctrl+o"),
+			key.WithHelp("ctrl+o", "switch domain"),
+		),
 		DeleteMailbox: key.NewBinding(
 			key.WithKeys("ctrl+k"),
 			key.WithHelp("ctrl+k", "delete mailbox"),
 		),
+		ShowLeaks: key.NewBinding(
+			key.WithKeys("ctrl+l"),
+			key.WithHelp("ctrl+l", "leaks"),
+		),
+		ShowSenders: key.NewBinding(
+			key.WithKeys("ctrl+f"),
+			key.WithHelp("ctrl+f", "senders"),
+		),
 
 		Select: key.NewBinding(
 			key.WithKeys("enter"),
 			key.WithHelp("enter", "select"),
 		),
+		TogglePin: key.NewBinding(
+			key.WithKeys("p"),
+			key.WithHelp("p", "star"),
+		),
+		ToggleSeen: key.NewBinding(
+			key.WithKeys("m"),
+			key.WithHelp("m", "read/unread"),
+		),
+		DeleteMails: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", "delete"),
+		),
+		BlockSender: key.NewBinding(
+			key.WithKeys("b"),
+			key.WithHelp("b", "block sender"),
+		),
+		ToggleThread: key.NewBinding(
+			key.WithKeys("t"),
+			key.WithHelp("t", "expand/collapse thread"),
+		),
+
+		Undo: key.NewBinding(
+			key.WithKeys("U"),
+			key.WithHelp("U", "undo delete"),
+		),
+
+		ToggleMarked: key.NewBinding(
+			key.WithKeys("v"),
+			key.WithHelp("v", "mark"),
+		),
+		ToggleMarkedAll: key.NewBinding(
+			key.WithKeys("V"),
+			key.WithHelp("V", "mark all"),
+		),
+		ClearMarked: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "clear marks"),
+		),
+
+		Search: key.NewBinding(
+			key.WithKeys("/"),
+			key.WithHelp("/", "search"),
+		),
+		SubmitSearch: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "search"),
+		),
+		CancelSearch: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "cancel"),
+		),
 
 		FocusMailboxes: key.NewBinding(
 			key.WithKeys("left", "h", "esc"),
@@ -470,7 +1134,7 @@ func (m *mailboxItem) ID() int {
 }
 
 func (m *mailboxItem) Label() string {
-	return m.mailbox.Email()
+	return m.mailbox.DisplayName()
 }
 
 func (m *mailboxItem) Badge() string {
@@ -0,0 +1,170 @@
+package leaks
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/core/tui/colors"
+	"github.com/ksdme/mail/internal/utils"
+)
+
+type LeaksReportMsg struct {
+	Leaks []models.Leak
+	Err   error
+}
+
+type LeaksDismissMsg struct{}
+
+// Shows the report of mails that look like they arrived on leaked addresses.
+type Model struct {
+	viewport viewport.Model
+
+	Width  int
+	Height int
+
+	KeyMap   KeyMap
+	Renderer *lipgloss.Renderer
+	Colors   colors.ColorPalette
+}
+
+func NewModel(renderer *lipgloss.Renderer, colors colors.ColorPalette) Model {
+	width := 64
+	height := 64
+
+	return Model{
+		viewport: viewport.New(width, height),
+
+		Width:  width,
+		Height: height,
+
+		KeyMap:   DefaultKeyMap(),
+		Renderer: renderer,
+		Colors:   colors,
+	}
+}
+
+func (m Model) Init() tea.Cmd {
+	return m.viewport.Init()
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.viewport.Width = m.Width
+		m.viewport.Height = m.Height
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.KeyMap.Dismiss):
+			return m, m.dismiss
+		}
+
+	case LeaksReportMsg:
+		m.viewport.SetContent(m.makeContent(msg))
+		m.viewport.SetYOffset(0)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m Model) View() string {
+	return m.viewport.View()
+}
+
+func (m Model) makeContent(report LeaksReportMsg) string {
+	titleStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		PaddingBottom(1)
+
+	labelStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		PaddingRight(1)
+
+	valueStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Text)
+
+	accentStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Accent)
+
+	title := titleStyle.Render("Leaked Addresses")
+	if report.Err != nil {
+		return lipgloss.JoinVertical(
+			lipgloss.Top,
+			title,
+			valueStyle.Render(fmt.Sprintf("could not build the report: %v", report.Err)),
+		)
+	}
+	if len(report.Leaks) == 0 {
+		return lipgloss.JoinVertical(
+			lipgloss.Top,
+			title,
+			valueStyle.Render(
+				"no leaks found, mails on mailboxes created for a site all came from that site",
+			),
+		)
+	}
+
+	lines := []string{title}
+	for _, leak := range report.Leaks {
+		age := fmt.Sprintf("%s ago", utils.RoundedAge(time.Since(leak.Mail.CreatedAt)))
+
+		lines = append(
+			lines,
+			lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				valueStyle.Render(leak.Mailbox.Email()),
+				labelStyle.PaddingLeft(1).Render("given to"),
+				accentStyle.Render(leak.Site),
+			),
+			lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Render("From"),
+				valueStyle.Render(leak.Mail.FromAddress),
+				labelStyle.PaddingLeft(1).Render(age),
+			),
+			lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Render("Subject"),
+				valueStyle.Render(utils.Decode(leak.Mail.DisplaySubject())),
+			),
+			"",
+		)
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Top, lines...)
+}
+
+func (m Model) dismiss() tea.Msg {
+	return LeaksDismissMsg{}
+}
+
+type KeyMap struct {
+	Dismiss key.Binding
+}
+
+func (m Model) Help() []key.Binding {
+	return []key.Binding{
+		m.KeyMap.Dismiss,
+	}
+}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Dismiss: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "go back"),
+		),
+	}
+}
@@ -0,0 +1,182 @@
+package lint
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	linter "github.com/ksdme/mail/internal/apps/mail/lint"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/core/tui/colors"
+	"github.com/ksdme/mail/internal/utils"
+)
+
+type LintReportMsg struct {
+	Mail   models.Mail
+	Report *linter.Report
+	Err    error
+}
+
+type LintDismissMsg struct{}
+
+// Shows the problems with the html of a mail.
+type Model struct {
+	viewport viewport.Model
+
+	Width  int
+	Height int
+
+	KeyMap   KeyMap
+	Renderer *lipgloss.Renderer
+	Colors   colors.ColorPalette
+}
+
+func NewModel(renderer *lipgloss.Renderer, colors colors.ColorPalette) Model {
+	width := 64
+	height := 64
+
+	return Model{
+		viewport: viewport.New(width, height),
+
+		Width:  width,
+		Height: height,
+
+		KeyMap:   DefaultKeyMap(),
+		Renderer: renderer,
+		Colors:   colors,
+	}
+}
+
+func (m Model) Init() tea.Cmd {
+	return m.viewport.Init()
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.viewport.Width = m.Width
+		m.viewport.Height = m.Height
+
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.KeyMap.Dismiss):
+			return m, m.dismiss
+		}
+
+	case LintReportMsg:
+		m.viewport.SetContent(m.makeContent(msg))
+		m.viewport.SetYOffset(0)
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m Model) View() string {
+	return m.viewport.View()
+}
+
+func (m Model) makeContent(msg LintReportMsg) string {
+	titleStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted)
+
+	labelStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		PaddingRight(1)
+
+	valueStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Text)
+
+	errorStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Accent).
+		PaddingRight(1)
+
+	title := lipgloss.JoinVertical(
+		lipgloss.Top,
+		titleStyle.Render("HTML Report"),
+		valueStyle.
+			PaddingBottom(1).
+			Render(utils.Decode(msg.Mail.DisplaySubject())),
+	)
+	if msg.Err != nil {
+		return lipgloss.JoinVertical(
+			lipgloss.Top,
+			title,
+			valueStyle.Render(fmt.Sprintf("could not build the report: %v", msg.Err)),
+		)
+	}
+
+	report := msg.Report
+	if report.HTMLSize == 0 {
+		return lipgloss.JoinVertical(
+			lipgloss.Top,
+			title,
+			valueStyle.Render("not an html mail"),
+		)
+	}
+
+	size := lipgloss.JoinHorizontal(
+		lipgloss.Left,
+		labelStyle.Render("Size"),
+		valueStyle.Render(fmt.Sprintf(
+			"%s, html %s of the %s gmail allows before clipping",
+			linter.FormatSize(report.Size),
+			linter.FormatSize(report.HTMLSize),
+			linter.FormatSize(linter.ClippingSize),
+		)),
+	)
+
+	lines := []string{title, size, ""}
+	if len(report.Issues) == 0 {
+		lines = append(lines, valueStyle.Render("no problems found"))
+	}
+	for _, issue := range report.Issues {
+		severity := labelStyle.Render(string(issue.Severity))
+		if issue.Severity == linter.Error {
+			severity = errorStyle.Render(string(issue.Severity))
+		}
+
+		lines = append(
+			lines,
+			lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				severity,
+				labelStyle.Render(issue.Rule),
+				valueStyle.Render(issue.Message),
+			),
+		)
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Top, lines...)
+}
+
+func (m Model) dismiss() tea.Msg {
+	return LintDismissMsg{}
+}
+
+type KeyMap struct {
+	Dismiss key.Binding
+}
+
+func (m Model) Help() []key.Binding {
+	return []key.Binding{
+		m.KeyMap.Dismiss,
+	}
+}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Dismiss: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "go back"),
+		),
+	}
+}
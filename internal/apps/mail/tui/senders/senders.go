@@ -0,0 +1,296 @@
+package senders
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/models"
+	"github.com/ksdme/mail/internal/core/tui/colors"
+	"github.com/uptrace/bun"
+)
+
+type SendersReportMsg struct {
+	Mailbox models.Mailbox
+	Filters []models.SenderFilter
+	Err     error
+}
+
+type SendersDismissMsg struct{}
+
+// Lists the senders allowed or blocked on a mailbox and lets them be
+// added or removed.
+type Model struct {
+	db      *bun.DB
+	account accounts.Account
+
+	mailbox models.Mailbox
+	filters []models.SenderFilter
+	err     error
+	cursor  int
+
+	// The input for the sender that is being added, allow tells whether it
+	// is going to be allowed or blocked.
+	input  textinput.Model
+	adding bool
+	allow  bool
+
+	Width  int
+	Height int
+
+	KeyMap   KeyMap
+	Renderer *lipgloss.Renderer
+	Colors   colors.ColorPalette
+}
+
+func NewModel(
+	db *bun.DB,
+	account accounts.Account,
+	renderer *lipgloss.Renderer,
+	colors colors.ColorPalette,
+) Model {
+	input := textinput.New()
+	input.Placeholder = "address or domain of the sender"
+	input.PromptStyle = renderer.NewStyle().Foreground(colors.Accent)
+	input.TextStyle = renderer.NewStyle().Foreground(colors.Text)
+	input.PlaceholderStyle = renderer.NewStyle().Foreground(colors.Muted)
+	input.Cursor.Style = renderer.NewStyle().Foreground(colors.Accent)
+
+	return Model{
+		db:      db,
+		account: account,
+
+		input: input,
+
+		Width:  64,
+		Height: 64,
+
+		KeyMap:   DefaultKeyMap(),
+		Renderer: renderer,
+		Colors:   colors,
+	}
+}
+
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		// The input takes over all the keys while a sender is being added.
+		if m.adding {
+			switch {
+			case key.Matches(msg, m.KeyMap.Submit):
+				m.adding = false
+				m.input.Blur()
+				return m, m.addSender(m.input.Value(), m.allow)
+
+			case key.Matches(msg, m.KeyMap.Cancel):
+				m.adding = false
+				m.input.Blur()
+				return m, nil
+			}
+
+			var cmd tea.Cmd
+			m.input, cmd = m.input.Update(msg)
+			return m, cmd
+		}
+
+		switch {
+		case key.Matches(msg, m.KeyMap.Dismiss):
+			return m, m.dismiss
+
+		case key.Matches(msg, m.KeyMap.Up):
+			m.cursor = max(m.cursor-1, 0)
+
+		case key.Matches(msg, m.KeyMap.Down):
+			m.cursor = max(min(m.cursor+1, len(m.filters)-1), 0)
+
+		case key.Matches(msg, m.KeyMap.Allow), key.Matches(msg, m.KeyMap.Block):
+			m.adding = true
+			m.allow = key.Matches(msg, m.KeyMap.Allow)
+			m.input.Prompt = "block "
+			if m.allow {
+				m.input.Prompt = "allow "
+			}
+			m.input.SetValue("")
+			m.input.Width = m.Width - lipgloss.Width(m.input.Prompt) - 1
+			return m, m.input.Focus()
+
+		case key.Matches(msg, m.KeyMap.Remove):
+			if m.cursor < len(m.filters) {
+				return m, m.removeSender(m.filters[m.cursor])
+			}
+		}
+
+	case SendersReportMsg:
+		m.mailbox = msg.Mailbox
+		m.filters = msg.Filters
+		m.err = msg.Err
+		m.cursor = max(min(m.cursor, len(m.filters)-1), 0)
+		return m, nil
+	}
+
+	return m, nil
+}
+
+// Returns a boolean indicating if a sender is being typed in.
+func (m Model) Editing() bool {
+	return m.adding
+}
+
+func (m Model) View() string {
+	titleStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		PaddingBottom(1)
+
+	labelStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Muted).
+		Width(6)
+
+	valueStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Text)
+
+	selectedStyle := m.Renderer.
+		NewStyle().
+		Foreground(m.Colors.Accent).
+		Bold(true)
+
+	lines := []string{titleStyle.Render(fmt.Sprintf("Senders on %s", m.mailbox.Email()))}
+	if m.err != nil {
+		lines = append(lines, valueStyle.Render(fmt.Sprintf("could not update the senders: %v", m.err)), "")
+	}
+
+	if len(m.filters) == 0 {
+		lines = append(
+			lines,
+			valueStyle.Render("mails from all senders are accepted, allow a sender to only accept mails from it"),
+		)
+	}
+	for index, filter := range m.filters {
+		style := valueStyle
+		if index == m.cursor {
+			style = selectedStyle
+		}
+		lines = append(
+			lines,
+			lipgloss.JoinHorizontal(
+				lipgloss.Left,
+				labelStyle.Render(filter.Kind()),
+				style.Render(filter.Sender),
+			),
+		)
+	}
+
+	if m.adding {
+		lines = append(lines, "", m.input.View())
+	}
+
+	return m.Renderer.
+		NewStyle().
+		Width(m.Width).
+		Height(m.Height).
+		Render(lipgloss.JoinVertical(lipgloss.Top, lines...))
+}
+
+func (m Model) refresh(err error) tea.Msg {
+	filters, lerr := models.ListSenderFilters(context.TODO(), m.db, m.mailbox)
+	if err == nil {
+		err = lerr
+	}
+	return SendersReportMsg{Mailbox: m.mailbox, Filters: filters, Err: err}
+}
+
+func (m Model) addSender(sender string, allow bool) tea.Cmd {
+	return func() tea.Msg {
+		_, err := models.CreateSenderFilter(context.TODO(), m.db, m.mailbox, sender, allow)
+		if err != nil {
+			slog.Debug("could not add sender", "mailbox", m.mailbox.ID, "err", err)
+		}
+		return m.refresh(err)
+	}
+}
+
+func (m Model) removeSender(filter models.SenderFilter) tea.Cmd {
+	return func() tea.Msg {
+		err := models.DeleteSenderFilter(context.TODO(), m.db, m.account, filter.ID)
+		if err != nil {
+			slog.Error("could not remove sender", "sender", filter.ID, "err", err)
+		}
+		return m.refresh(err)
+	}
+}
+
+func (m Model) dismiss() tea.Msg {
+	return SendersDismissMsg{}
+}
+
+type KeyMap struct {
+	Up      key.Binding
+	Down    key.Binding
+	Allow   key.Binding
+	Block   key.Binding
+	Remove  key.Binding
+	Submit  key.Binding
+	Cancel  key.Binding
+	Dismiss key.Binding
+}
+
+func (m Model) Help() []key.Binding {
+	if m.adding {
+		return []key.Binding{m.KeyMap.Submit, m.KeyMap.Cancel}
+	}
+
+	return []key.Binding{
+		m.KeyMap.Allow,
+		m.KeyMap.Block,
+		m.KeyMap.Remove,
+		m.KeyMap.Dismiss,
+	}
+}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Up: key.NewBinding(
+			key.WithKeys("up", "k"),
+			key.WithHelp("↑/k", "up"),
+		),
+		Down: key.NewBinding(
+			key.WithKeys("down", "j"),
+			key.WithHelp("↓/j", "down"),
+		),
+		Allow: key.NewBinding(
+			key.WithKeys("a"),
+			key.WithHelp("a", "allow sender"),
+		),
+		Block: key.NewBinding(
+			key.WithKeys("b"),
+			key.WithHelp("b", "block sender"),
+		),
+		Remove: key.NewBinding(
+			key.WithKeys("x"),
+			key.WithHelp("x", "remove"),
+		),
+		Submit: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "add"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "cancel"),
+		),
+		Dismiss: key.NewBinding(
+			key.WithKeys("esc"),
+			key.WithHelp("esc", "go back"),
+		),
+	}
+}
@@ -1,14 +1,29 @@
 package tui
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
 	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	accounts "github.com/ksdme/mail/internal/apps/accounts/models"
+	"github.com/ksdme/mail/internal/apps/mail/events"
+	"github.com/ksdme/mail/internal/apps/mail/models"
 	"github.com/ksdme/mail/internal/apps/mail/tui/email"
 	"github.com/ksdme/mail/internal/apps/mail/tui/home"
+	"github.com/ksdme/mail/internal/apps/mail/tui/leaks"
+	"github.com/ksdme/mail/internal/apps/mail/tui/lint"
+	"github.com/ksdme/mail/internal/apps/mail/tui/senders"
+	"github.com/ksdme/mail/internal/core"
 	"github.com/ksdme/mail/internal/core/tui/colors"
+	"github.com/ksdme/mail/internal/core/tui/components/confirm"
 	"github.com/ksdme/mail/internal/core/tui/components/help"
+	"github.com/ksdme/mail/internal/core/tui/notify"
+	"github.com/ksdme/mail/internal/utils"
 	"github.com/uptrace/bun"
 )
 
@@ -17,8 +32,23 @@ type mode int
 const (
 	Home mode = iota
 	Email
+	Leaks
+	Lint
+	Senders
 )
 
+type mailReceivedMsg struct {
+	mail events.MailReceived
+}
+
+type notificationMsg struct {
+	sequence string
+}
+
+type notificationSentMsg struct {
+	id int
+}
+
 // Represents the top most model.
 type Model struct {
 	db      *bun.DB
@@ -27,6 +57,24 @@ type Model struct {
 	mode  mode
 	home  home.Model
 	email email.Model
+	leaks leaks.Model
+	lint  lint.Model
+
+	senders senders.Model
+
+	// Shown over the other modes when an action needs to be confirmed.
+	confirm confirm.Model
+
+	// The mails received on the account, the subscription is only for this
+	// session, so that it does not interfere with the other ones.
+	received    <-chan events.MailReceived
+	unsubscribe func()
+
+	// The escape sequence of the last desktop notification. It is written
+	// out with the view, so that it cannot end up in the middle of a frame,
+	// and, it is kept around for a moment so that a frame does pick it up.
+	notification   string
+	notificationID int
 
 	width  int
 	height int
@@ -42,17 +90,29 @@ type Model struct {
 func NewModel(
 	db *bun.DB,
 	account accounts.Account,
+	clipboard core.Clipboard,
 	renderer *lipgloss.Renderer,
 	colors colors.ColorPalette,
 	quit tea.Cmd,
 ) Model {
+	received, unsubscribe := events.MailReceivedSignal.Subscribe(account.ID, 64)
+
 	return Model{
 		db:      db,
 		account: account,
 
 		mode:  Home,
-		home:  home.NewModel(db, renderer, colors),
-		email: email.NewModel(renderer, colors),
+		home:  home.NewModel(db, account, renderer, colors),
+		email: email.NewModel(account, clipboard, renderer, colors),
+		leaks: leaks.NewModel(renderer, colors),
+		lint:  lint.NewModel(renderer, colors),
+
+		senders: senders.NewModel(db, account, renderer, colors),
+
+		confirm: confirm.NewModel(renderer, colors),
+
+		received:    received,
+		unsubscribe: unsubscribe,
 
 		KeyMap:   DefaultKeyMap(),
 		Renderer: renderer,
@@ -66,6 +126,10 @@ func (m Model) Init() tea.Cmd {
 	return tea.Batch(
 		m.home.Init(),
 		m.email.Init(),
+		m.leaks.Init(),
+		m.lint.Init(),
+		m.senders.Init(),
+		m.listenToMailReceived,
 	)
 }
 
@@ -83,17 +147,68 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.email.Width = m.home.Width
 		m.email.Height = m.home.Height
 
+		m.leaks.Width = m.home.Width
+		m.leaks.Height = m.home.Height
+
+		m.lint.Width = m.home.Width
+		m.lint.Height = m.home.Height
+
+		m.senders.Width = m.home.Width
+		m.senders.Height = m.home.Height
+
+		// Matches the padding around the content in the view.
+		m.confirm.X = 6
+		m.confirm.Y = 2
+		m.confirm.Width = m.home.Width
+		m.confirm.Height = m.home.Height
+
 		m.home, _ = m.home.Update(msg)
 		m.email, _ = m.email.Update(msg)
+		m.leaks, _ = m.leaks.Update(msg)
+		m.lint, _ = m.lint.Update(msg)
+		m.senders, _ = m.senders.Update(msg)
 		return m, cmd
 
+	case tea.KeyMsg, tea.MouseMsg:
+		if m.confirm.Active() {
+			m.confirm, cmd = m.confirm.Update(msg)
+			return m, cmd
+		}
+
+	case confirm.AskMsg:
+		m.confirm.Show(msg)
+		return m, nil
+	}
+
+	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch {
-		case key.Matches(msg, m.KeyMap.Quit):
+		case key.Matches(msg, m.KeyMap.Quit) && (!m.editing() || msg.String() == "ctrl+c"):
 			m.quitting = true
 			return m, m.quit
 		}
 
+	case mailReceivedMsg:
+		return m, tea.Batch(
+			m.notify(msg.mail),
+			m.listenToMailReceived,
+		)
+
+	case notificationMsg:
+		m.notificationID++
+		m.notification = msg.sequence
+
+		id := m.notificationID
+		return m, tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+			return notificationSentMsg{id}
+		})
+
+	case notificationSentMsg:
+		if msg.id == m.notificationID {
+			m.notification = ""
+		}
+		return m, nil
+
 	case home.MailboxRealTimeUpdate:
 		m.home, cmd = m.home.Update(msg)
 		return m, cmd
@@ -106,6 +221,33 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case email.MailDismissMsg:
 		m.mode = Home
 		return m, nil
+
+	case leaks.LeaksReportMsg:
+		m.mode = Leaks
+		m.leaks, cmd = m.leaks.Update(msg)
+		return m, cmd
+
+	case leaks.LeaksDismissMsg:
+		m.mode = Home
+		return m, nil
+
+	case lint.LintReportMsg:
+		m.mode = Lint
+		m.lint, cmd = m.lint.Update(msg)
+		return m, cmd
+
+	case lint.LintDismissMsg:
+		m.mode = Email
+		return m, nil
+
+	case senders.SendersReportMsg:
+		m.mode = Senders
+		m.senders, cmd = m.senders.Update(msg)
+		return m, cmd
+
+	case senders.SendersDismissMsg:
+		m.mode = Home
+		return m, nil
 	}
 
 	if m.mode == Home {
@@ -114,6 +256,15 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	} else if m.mode == Email {
 		m.email, cmd = m.email.Update(msg)
 		return m, cmd
+	} else if m.mode == Leaks {
+		m.leaks, cmd = m.leaks.Update(msg)
+		return m, cmd
+	} else if m.mode == Lint {
+		m.lint, cmd = m.lint.Update(msg)
+		return m, cmd
+	} else if m.mode == Senders {
+		m.senders, cmd = m.senders.Update(msg)
+		return m, cmd
 	}
 
 	return m, nil
@@ -126,13 +277,21 @@ func (m Model) View() string {
 	}
 
 	content := "loading"
-	if m.mode == Home {
+	if m.confirm.Active() {
+		content = m.confirm.View()
+	} else if m.mode == Home {
 		content = m.home.View()
 	} else if m.mode == Email {
 		content = m.email.View()
+	} else if m.mode == Leaks {
+		content = m.leaks.View()
+	} else if m.mode == Lint {
+		content = m.lint.View()
+	} else if m.mode == Senders {
+		content = m.senders.View()
 	}
 
-	return m.Renderer.
+	view := m.Renderer.
 		NewStyle().
 		Padding(2, 6).
 		Render(
@@ -142,20 +301,87 @@ func (m Model) View() string {
 				help.View(m.Help(), m.Renderer, m.Colors),
 			),
 		)
+
+	// The sequence goes on the last line, it is blank and does not change,
+	// so, the renderer only writes it out once.
+	if m.notification != "" {
+		index := strings.LastIndex(view, "\n") + 1
+		view = view[:index] + m.notification + view[index:]
+	}
+	return view
+}
+
+func (m Model) listenToMailReceived() tea.Msg {
+	if mail, ok := <-m.received; ok {
+		return mailReceivedMsg{mail}
+	}
+
+	return nil
+}
+
+// Stops listening to the mails received on the account, it needs to be
+// called once the session is over.
+func (m Model) CleanUp() {
+	m.unsubscribe()
+}
+
+// Sends a desktop notification for the mail if the account has them enabled.
+// The settings are looked up every time so that changes apply right away.
+func (m Model) notify(mail events.MailReceived) tea.Cmd {
+	return func() tea.Msg {
+		settings, err := models.GetSettings(context.TODO(), m.db, m.account)
+		if err != nil {
+			slog.Error("could not get settings", "account", m.account.ID, "err", err)
+			return nil
+		}
+
+		protocol, _ := notify.ParseProtocol(settings.Notifications)
+		if protocol == notify.Off && !settings.Bell {
+			return nil
+		}
+
+		from := mail.FromName
+		if from == "" {
+			from = mail.FromAddress
+		}
+		title := fmt.Sprintf("New mail from %s", from)
+		return notificationMsg{
+			notify.Sequence(protocol, title, utils.Decode(mail.Subject), settings.Bell),
+		}
+	}
 }
 
 func (m Model) Help() []key.Binding {
 	var bindings []key.Binding
 
+	if m.confirm.Active() {
+		return m.confirm.Help()
+	}
+
 	if m.mode == Home {
 		bindings = append(bindings, m.home.Help()...)
 	} else if m.mode == Email {
 		bindings = append(bindings, m.email.Help()...)
+	} else if m.mode == Leaks {
+		bindings = append(bindings, m.leaks.Help()...)
+	} else if m.mode == Lint {
+		bindings = append(bindings, m.lint.Help()...)
+	} else if m.mode == Senders {
+		bindings = append(bindings, m.senders.Help()...)
 	}
 
+	if m.editing() {
+		return bindings
+	}
 	return append(bindings, m.KeyMap.Quit)
 }
 
+// Returns a boolean indicating if text is being typed in, the quit key is
+// left to the input in that case.
+func (m Model) editing() bool {
+	return (m.mode == Home && m.home.Editing()) || (m.mode == Senders && m.senders.Editing())
+}
+
 type KeyMap struct {
 	Quit key.Binding
 }
@@ -2,6 +2,11 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
 
 	"github.com/caarlos0/env/v11"
 )
@@ -25,12 +30,69 @@ type coreSettings struct {
 	ClipboardAppEnabled bool `env:"CLIPBOARD_APP_ENABLED" envDefault:"true"`
 
 	Signature string `env:"SIGNATURE"`
+
+	// Whether the interfaces capture the mouse, it lets dialogs be clicked
+	// on, but, the text on the terminal cannot be selected anymore.
+	TUIMouse bool `env:"TUI_MOUSE"`
 }
 
 // Settings related to the mail app.
 type mailSettings struct {
 	MXHost       string `env:"MX_HOST" envDefault:"localhost"`
 	SMTPBindAddr string `env:"SMTP_BIND_ADDR" envDefault:"127.0.0.1:1025"`
+
+	// Other domains mails are accepted on, each mailbox is bound to one of
+	// them or to the mx host, which is the default.
+	MXDomains []string `env:"MX_DOMAINS"`
+
+	// Optional LMTP listener for an upstream MTA that delivers mails locally,
+	// either a tcp address, or, a unix socket path like unix:/run/mail.sock.
+	LMTPBindAddr string `env:"LMTP_BIND_ADDR"`
+
+	// Permissions on the unix socket in octal, the MTA needs to be able to
+	// write to it, but, anyone who can could deliver mails.
+	LMTPSocketMode string `env:"LMTP_SOCKET_MODE" envDefault:"0660"`
+
+	// Optional IMAP listener to read the mailboxes from mail clients, the
+	// login tokens are sent in plain text, so, it should be put behind a
+	// proxy that terminates tls.
+	IMAPBindAddr string `env:"IMAP_BIND_ADDR"`
+
+	// Optional POP3 listener for test clients that cannot speak imap, it
+	// has the same caveat about the tokens being sent in plain text.
+	POP3BindAddr string `env:"POP3_BIND_ADDR"`
+
+	// How long mails are kept around by default. Accounts and mailboxes
+	// can override it.
+	Retention time.Duration `env:"MAIL_RETENTION" envDefault:"48h"`
+
+	// How long deleted mails and mailboxes stay in the trash before they
+	// are purged.
+	TrashRetention time.Duration `env:"MAIL_TRASH_RETENTION" envDefault:"24h"`
+
+	// Heuristics used to find one-time codes and verification links on
+	// received mails.
+	OTPKeywords  []string `env:"MAIL_OTP_KEYWORDS" envDefault:"code,otp,passcode,password,pin,verification,verify,confirm,one-time,token,login,sign in"`
+	OTPMinDigits int      `env:"MAIL_OTP_MIN_DIGITS" envDefault:"4"`
+	OTPMaxDigits int      `env:"MAIL_OTP_MAX_DIGITS" envDefault:"8"`
+	LinkKeywords []string `env:"MAIL_LINK_KEYWORDS" envDefault:"verify,verification,confirm,activate,magic,login,signin,sign-in,auth,token,reset"`
+}
+
+// Returns the domains mails are accepted on, the mx host comes first.
+func (s mailSettings) Domains() []string {
+	domains := []string{strings.ToLower(s.MXHost)}
+	for _, domain := range s.MXDomains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" && !slices.Contains(domains, domain) {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// Returns a boolean indicating if mails are accepted on the domain.
+func (s mailSettings) HasDomain(domain string) bool {
+	return slices.Contains(s.Domains(), strings.ToLower(domain))
 }
 
 // Settings related to the clipboard app.
@@ -39,6 +101,12 @@ type clipboardSettings struct {
 }
 
 func init() {
+	// Tests run without the environment of the server, and, the entropy is
+	// the only setting they cannot do without.
+	if testing.Testing() && os.Getenv("ENTROPY") == "" {
+		os.Setenv("ENTROPY", "testing")
+	}
+
 	if err := env.Parse(&Core); err != nil {
 		panic(fmt.Sprintf("could not parse core configuration: %v", err))
 	}
@@ -47,6 +115,12 @@ func init() {
 		if err := env.Parse(&Mail); err != nil {
 			panic(fmt.Sprintf("could not parse mail configuration: %v", err))
 		}
+		if Mail.Retention <= 0 {
+			panic("could not parse mail configuration: MAIL_RETENTION needs to be positive")
+		}
+		if Mail.TrashRetention <= 0 {
+			panic("could not parse mail configuration: MAIL_TRASH_RETENTION needs to be positive")
+		}
 	}
 
 	if Core.ClipboardAppEnabled {
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/ssh"
@@ -14,8 +16,10 @@ type App interface {
 	Info() (name string, title string, description string)
 
 	// This method will be run before serving any request on this
-	// application. You can initialize your workers here.
-	Init()
+	// application. You can initialize your workers here. All the enabled
+	// apps are passed along so that the app can look up the capabilities
+	// it needs from the other apps using Find.
+	Init(apps []App)
 
 	// An App can be booted up in two ways. The client can directly request
 	// the services of a specific app using a sub command. When that happens,
@@ -52,3 +56,25 @@ type App interface {
 	// Called to close and cleanup the application during shutdown.
 	CleanUp()
 }
+
+// Apps can expose capabilities to the other apps by implementing one of the
+// interfaces below. Since any app can be disabled, the apps depending on a
+// capability should always handle it being unavailable.
+
+// Implemented by the app that manages the shared clipboard of an account.
+type Clipboard interface {
+	// Replaces the contents on the clipboard of the account.
+	Copy(ctx context.Context, account accounts.Account, value []byte) error
+}
+
+// Returns the first app that implements the capability.
+func Find[T any](apps []App) (T, bool) {
+	for _, app := range apps {
+		if capability, ok := app.(T); ok {
+			return capability, true
+		}
+	}
+
+	var empty T
+	return empty, false
+}
@@ -0,0 +1,252 @@
+package confirm
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/ksdme/mail/internal/core/tui/colors"
+)
+
+// Asks the model that owns the confirm modal to show it. The confirm
+// command is only run if the user goes ahead with the action.
+type AskMsg struct {
+	Title   string
+	Message string
+	Action  string
+	Confirm tea.Cmd
+}
+
+// Returns a command that asks for a confirmation before running the action.
+func Ask(title string, message string, action string, confirm tea.Cmd) tea.Cmd {
+	return func() tea.Msg {
+		return AskMsg{
+			Title:   title,
+			Message: message,
+			Action:  action,
+			Confirm: confirm,
+		}
+	}
+}
+
+const (
+	cancelButton = iota
+	confirmButton
+)
+
+// A modal that asks the user to confirm a destructive action. It is meant
+// to be owned by the top most model of an app, which routes all the key and
+// mouse messages to it while it is active, and, renders it in place of its
+// contents.
+type Model struct {
+	ask     AskMsg
+	active  bool
+	focused int
+
+	// The area the modal is centered in, X and Y are the offsets of the
+	// area on the screen, they are needed to handle mouse clicks.
+	X      int
+	Y      int
+	Width  int
+	Height int
+
+	KeyMap   KeyMap
+	Renderer *lipgloss.Renderer
+	Colors   colors.ColorPalette
+}
+
+func NewModel(renderer *lipgloss.Renderer, colors colors.ColorPalette) Model {
+	return Model{
+		KeyMap:   DefaultKeyMap(),
+		Renderer: renderer,
+		Colors:   colors,
+	}
+}
+
+// Shows the modal, the cancel button is focused by default.
+func (m *Model) Show(ask AskMsg) {
+	m.ask = ask
+	m.active = true
+	m.focused = cancelButton
+}
+
+func (m Model) Active() bool {
+	return m.active
+}
+
+func (m Model) Update(msg tea.Msg) (Model, tea.Cmd) {
+	if !m.active {
+		return m, nil
+	}
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, m.KeyMap.Confirm):
+			return m.choose(confirmButton)
+
+		case key.Matches(msg, m.KeyMap.Cancel):
+			return m.choose(cancelButton)
+
+		case key.Matches(msg, m.KeyMap.Switch):
+			m.focused = 1 - m.focused
+
+		case key.Matches(msg, m.KeyMap.Select):
+			return m.choose(m.focused)
+		}
+
+	case tea.MouseMsg:
+		button, inside := m.hit(msg.X, msg.Y)
+		switch msg.Action {
+		case tea.MouseActionMotion:
+			if button >= 0 {
+				m.focused = button
+			}
+
+		case tea.MouseActionRelease:
+			if msg.Button != tea.MouseButtonLeft {
+				break
+			}
+			if button >= 0 {
+				return m.choose(button)
+			}
+
+			// Clicking outside the modal dismisses it.
+			if !inside {
+				return m.choose(cancelButton)
+			}
+		}
+	}
+
+	return m, nil
+}
+
+func (m Model) choose(button int) (Model, tea.Cmd) {
+	m.active = false
+	if button == confirmButton {
+		return m, m.ask.Confirm
+	}
+	return m, nil
+}
+
+func (m Model) View() string {
+	box, left, top, _ := m.layout()
+	return m.Renderer.
+		NewStyle().
+		Width(m.Width).
+		Height(m.Height).
+		PaddingLeft(left).
+		PaddingTop(top).
+		Render(box)
+}
+
+// Renders the modal and works out where it and its buttons are placed.
+// The buttons are returned as the column ranges they cover on the last
+// line of the box.
+func (m Model) layout() (string, int, int, [2][2]int) {
+	width := min(max(m.Width/2, 40), m.Width-4)
+
+	title := m.Renderer.
+		NewStyle().
+		Bold(true).
+		Foreground(m.Colors.Accent).
+		Render(m.ask.Title)
+
+	message := m.Renderer.
+		NewStyle().
+		Width(width).
+		PaddingTop(1).
+		Foreground(m.Colors.Text).
+		Render(m.ask.Message)
+
+	labels := [2]string{"Cancel", m.ask.Action}
+	var buttons [2]string
+	for index, label := range labels {
+		style := m.Renderer.NewStyle().Padding(0, 1).Foreground(m.Colors.Muted)
+		if index == m.focused {
+			style = style.Reverse(true).Bold(true).Foreground(m.Colors.Accent)
+		}
+		buttons[index] = style.Render(label)
+	}
+
+	gap := "  "
+	row := lipgloss.JoinHorizontal(lipgloss.Top, buttons[0], gap, buttons[1])
+	offset := width - lipgloss.Width(row)
+	row = m.Renderer.NewStyle().PaddingTop(1).PaddingLeft(max(offset, 0)).Render(row)
+
+	border := 1
+	padding := [2]int{1, 2}
+	box := m.Renderer.
+		NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(m.Colors.Accent).
+		Padding(padding[0], padding[1]).
+		Render(lipgloss.JoinVertical(lipgloss.Left, title, message, row))
+
+	left := max((m.Width-lipgloss.Width(box))/2, 0)
+	top := max((m.Height-lipgloss.Height(box))/2, 0)
+
+	start := border + padding[1] + max(offset, 0)
+	cancel := [2]int{start, start + lipgloss.Width(buttons[0])}
+	start = cancel[1] + len(gap)
+	confirm := [2]int{start, start + lipgloss.Width(buttons[1])}
+
+	return box, left, top, [2][2]int{cancel, confirm}
+}
+
+// Returns the button at the position on the screen, or, -1 if there isn't
+// one, along with whether the position is within the modal.
+func (m Model) hit(x, y int) (int, bool) {
+	box, left, top, buttons := m.layout()
+
+	x -= m.X + left
+	y -= m.Y + top
+	inside := x >= 0 && y >= 0 && x < lipgloss.Width(box) && y < lipgloss.Height(box)
+
+	// The buttons are on the line right above the bottom border and padding.
+	if y != lipgloss.Height(box)-3 {
+		return -1, inside
+	}
+	for index, button := range buttons {
+		if x >= button[0] && x < button[1] {
+			return index, inside
+		}
+	}
+	return -1, inside
+}
+
+func (m Model) Help() []key.Binding {
+	return []key.Binding{
+		m.KeyMap.Switch,
+		m.KeyMap.Select,
+		m.KeyMap.Confirm,
+		m.KeyMap.Cancel,
+	}
+}
+
+type KeyMap struct {
+	Switch  key.Binding
+	Select  key.Binding
+	Confirm key.Binding
+	Cancel  key.Binding
+}
+
+func DefaultKeyMap() KeyMap {
+	return KeyMap{
+		Switch: key.NewBinding(
+			key.WithKeys("tab", "shift+tab", "left", "right", "h", "l"),
+			key.WithHelp("tab", "switch"),
+		),
+		Select: key.NewBinding(
+			key.WithKeys("enter", " "),
+			key.WithHelp("enter", "select"),
+		),
+		Confirm: key.NewBinding(
+			key.WithKeys("y"),
+			key.WithHelp("y", "yes"),
+		),
+		Cancel: key.NewBinding(
+			key.WithKeys("n", "esc", "q", "ctrl+c"),
+			key.WithHelp("n/esc", "no"),
+		),
+	}
+}
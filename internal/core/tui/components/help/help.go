@@ -20,7 +20,7 @@ func View(bindings []key.Binding, renderer *lipgloss.Renderer, colors colors.Col
 	items := []string{}
 	for _, binding := range bindings {
 		help := binding.Help()
-		if len(help.Desc) == 0 || len(help.Key) == 0 {
+		if !binding.Enabled() || len(help.Desc) == 0 || len(help.Key) == 0 {
 			continue
 		}
 
@@ -1,5 +1,6 @@
 // Borrowed from https://github.com/charmbracelet/bubbles/blob/36baf3d64ee64d2768c65c516701493d9a271232/table/table.go
 // Adds optimization to the StyleFunc implementation and fixes the selection override.
+// Also adds marking rows, which is used for acting on multiple rows at once.
 package table
 
 import (
@@ -19,6 +20,7 @@ type Model struct {
 	cols      []Column
 	rows      []Row
 	cursor    int
+	marked    map[int]bool
 	focus     bool
 	styles    Styles
 	styleFunc StyleFunc
@@ -112,6 +114,7 @@ type Styles struct {
 	Header   lipgloss.Style
 	Cell     lipgloss.Style
 	Selected lipgloss.Style
+	Marked   lipgloss.Style
 }
 
 // DefaultStyles returns a set of default style definitions for this table.
@@ -124,6 +127,7 @@ func DefaultStyles(renderer *lipgloss.Renderer) Styles {
 		Selected: renderer.NewStyle(),
 		Header:   renderer.NewStyle(),
 		Cell:     renderer.NewStyle(),
+		Marked:   renderer.NewStyle().Reverse(true),
 	}
 }
 
@@ -142,6 +146,7 @@ type Option func(*Model)
 func New(opts ...Option) Model {
 	m := Model{
 		cursor:   0,
+		marked:   make(map[int]bool),
 		viewport: viewport.New(0, 20),
 
 		KeyMap: DefaultKeyMap(),
@@ -330,9 +335,67 @@ func (m *Model) SetRows(r []Row) {
 	}
 	m.rows = r
 	m.cursor = cursor
+
+	// Forget the marks on rows that are gone.
+	marked := make(map[int]bool)
+	for _, row := range r {
+		if m.marked[row.ID] {
+			marked[row.ID] = true
+		}
+	}
+	m.marked = marked
+
+	m.UpdateViewport()
+}
+
+// ToggleMarked marks or unmarks the row under the cursor.
+func (m *Model) ToggleMarked() {
+	if row, err := m.SelectedRow(); err == nil {
+		if m.marked[row.ID] {
+			delete(m.marked, row.ID)
+		} else {
+			m.marked[row.ID] = true
+		}
+		m.UpdateViewport()
+	}
+}
+
+// ToggleMarkedAll marks all the rows, or, unmarks them if all of them are
+// already marked.
+func (m *Model) ToggleMarkedAll() {
+	if len(m.marked) == len(m.rows) {
+		m.ClearMarked()
+		return
+	}
+
+	for _, row := range m.rows {
+		m.marked[row.ID] = true
+	}
 	m.UpdateViewport()
 }
 
+// ClearMarked unmarks all the rows.
+func (m *Model) ClearMarked() {
+	m.marked = make(map[int]bool)
+	m.UpdateViewport()
+}
+
+// HasMarked returns a boolean indicating if any of the rows are marked.
+func (m Model) HasMarked() bool {
+	return len(m.marked) > 0
+}
+
+// MarkedRows returns the marked rows in the order they appear in.
+func (m Model) MarkedRows() []Row {
+	var rows []Row
+	for _, row := range m.rows {
+		if m.marked[row.ID] {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
 // SetColumns sets a new columns state.
 func (m *Model) SetColumns(c []Column) {
 	m.cols = c
@@ -434,12 +497,17 @@ func (m *Model) renderRow(r int) string {
 	var cellStyle lipgloss.Style
 	if m.styleFunc != nil {
 		cellStyle = m.styleFunc(r)
-		if r == m.cursor && m.Focused() {
-			cellStyle = cellStyle.UnsetForeground().Inherit(m.styles.Selected)
-		}
 	} else {
 		cellStyle = m.styles.Cell
 	}
+	// Marked rows keep the rest of their style, and, the cursor still
+	// stands out on them.
+	if m.marked[m.rows[r].ID] {
+		cellStyle = cellStyle.Inherit(m.styles.Marked)
+	}
+	if r == m.cursor && m.Focused() {
+		cellStyle = cellStyle.UnsetForeground().Inherit(m.styles.Selected)
+	}
 
 	s := make([]string, 0, len(m.cols))
 	for i, value := range m.rows[r].Cols {
@@ -0,0 +1,73 @@
+// Package notify builds the escape sequences that ask terminals to show a
+// desktop notification. Terminals that don't understand them ignore them.
+package notify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ksdme/mail/internal/utils"
+)
+
+// The escape sequences a notification can be sent with.
+type Protocol string
+
+const (
+	Off Protocol = "off"
+
+	// Supported by iTerm2, kitty, WezTerm, Windows Terminal and others.
+	// It only carries a message, so, the title is prepended to it.
+	OSC9 Protocol = "osc9"
+
+	// Supported by urxvt, foot, Ghostty, WezTerm and the vte based terminals.
+	OSC777 Protocol = "osc777"
+)
+
+// The protocols that can be configured, in the order they are listed in.
+var Protocols = []Protocol{Off, OSC9, OSC777}
+
+// Parses the name of a protocol, an empty name is the same as off.
+func ParseProtocol(name string) (Protocol, error) {
+	if name == "" {
+		return Off, nil
+	}
+	for _, protocol := range Protocols {
+		if strings.EqualFold(name, string(protocol)) {
+			return protocol, nil
+		}
+	}
+	return Off, fmt.Errorf("unknown notification protocol %q, use off, osc9 or osc777", name)
+}
+
+// Returns the escape sequence for a notification, followed by a bell if it
+// was asked for. The bell is rung even if the notifications are off.
+func Sequence(protocol Protocol, title string, body string, bell bool) string {
+	title = sanitize(title)
+	body = sanitize(body)
+
+	var sequence string
+	switch protocol {
+	case OSC9:
+		message := body
+		if title != "" {
+			message = fmt.Sprintf("%s: %s", title, body)
+		}
+		sequence = fmt.Sprintf("\x1b]9;%s\x07", message)
+
+	case OSC777:
+		// Semicolons separate the fields, so, the title cannot have any.
+		title = strings.ReplaceAll(title, ";", ",")
+		sequence = fmt.Sprintf("\x1b]777;notify;%s;%s\x07", title, body)
+	}
+
+	if bell {
+		sequence += "\a"
+	}
+	return sequence
+}
+
+// Drops the control characters that would end the sequence early and
+// collapses the whitespace.
+func sanitize(value string) string {
+	return strings.Join(strings.Fields(utils.StripControl(value)), " ")
+}
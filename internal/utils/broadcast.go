@@ -8,14 +8,16 @@ import (
 // of always cleaning up after itself. You can also emit messages to
 // topics that don't exist yet. Those messages will however be drained away.
 type BroadcastBus[S comparable, M any] struct {
-	channels map[S][]chan M
-	lock     sync.Mutex
+	channels    map[S][]chan M
+	subscribers map[S][]chan M
+	lock        sync.Mutex
 }
 
 func NewBroadcastBus[S comparable, M any]() BroadcastBus[S, M] {
 	return BroadcastBus[S, M]{
-		channels: make(map[S][]chan M),
-		lock:     sync.Mutex{},
+		channels:    make(map[S][]chan M),
+		subscribers: make(map[S][]chan M),
+		lock:        sync.Mutex{},
 	}
 }
 
@@ -26,6 +28,15 @@ func (b *BroadcastBus[S, M]) Emit(subject S, message M) {
 	if ok {
 		delete(b.channels, subject)
 	}
+
+	// Subscribers are sent messages while holding the lock so that
+	// they cannot be closed in the meantime.
+	for _, channel := range b.subscribers[subject] {
+		select {
+		case channel <- message:
+		default:
+		}
+	}
 	b.lock.Unlock()
 
 	for _, channel := range channels {
@@ -59,8 +70,43 @@ func (b *BroadcastBus[S, M]) Wait(subject S) (M, bool) {
 	}
 }
 
+// Subscribe to all the messages on a topic until the returned function
+// is called. Unlike Wait, messages emitted while the subscriber is busy are
+// buffered up to the given size instead of being dropped.
+func (b *BroadcastBus[S, M]) Subscribe(subject S, size int) (<-chan M, func()) {
+	b.lock.Lock()
+	channel := make(chan M, size)
+	b.subscribers[subject] = append(b.subscribers[subject], channel)
+	b.lock.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.lock.Lock()
+			defer b.lock.Unlock()
+
+			subscribers := b.subscribers[subject]
+			for index, element := range subscribers {
+				if element == channel {
+					subscribers = append(subscribers[:index], subscribers[index+1:]...)
+					break
+				}
+			}
+			if len(subscribers) == 0 {
+				delete(b.subscribers, subject)
+			} else {
+				b.subscribers[subject] = subscribers
+			}
+
+			close(channel)
+		})
+	}
+
+	return channel, unsubscribe
+}
+
 // Clean up a topic on the bus. All pending waits will resolve
-// with a done flag.
+// with a done flag. Subscriptions are left untouched.
 func (b *BroadcastBus[S, M]) CleanUp(subject S) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -0,0 +1,17 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Replaces the control characters on the text with spaces, so that text
+// from mails cannot inject escape sequences of its own into the terminal.
+func StripControl(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
@@ -4,6 +4,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/bubbletea"
+	"github.com/ksdme/mail/internal/config"
 	"github.com/muesli/termenv"
 )
 
@@ -11,6 +12,9 @@ import (
 func RunTeaInSession(next ssh.Handler, session ssh.Session, model tea.Model) {
 	middleware := bubbletea.MiddlewareWithColorProfile(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 		options := []tea.ProgramOption{tea.WithAltScreen()}
+		if config.Core.TUIMouse {
+			options = append(options, tea.WithMouseCellMotion())
+		}
 		return model, options
 	}, termenv.ANSI)
 
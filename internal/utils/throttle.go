@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// Keeps track of the failed attempts from each address. Addresses are
+// refused once they fail too many times within the window.
+type Throttle struct {
+	limit  int
+	window time.Duration
+
+	failures map[string][]time.Time
+	lock     sync.Mutex
+}
+
+func NewThrottle(limit int, window time.Duration) *Throttle {
+	return &Throttle{
+		limit:    limit,
+		window:   window,
+		failures: make(map[string][]time.Time),
+	}
+}
+
+// Returns a boolean indicating if the address can make another attempt.
+func (t *Throttle) Allowed(address net.Addr) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	host := t.host(address)
+	t.forget(host)
+	return len(t.failures[host]) < t.limit
+}
+
+// Records a failed attempt from the address.
+func (t *Throttle) Fail(address net.Addr) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	host := t.host(address)
+	t.forget(host)
+	t.failures[host] = append(t.failures[host], time.Now())
+}
+
+// Drops the failures on the host that are older than the window.
+func (t *Throttle) forget(host string) {
+	var kept []time.Time
+	for _, failure := range t.failures[host] {
+		if time.Since(failure) < t.window {
+			kept = append(kept, failure)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(t.failures, host)
+	} else {
+		t.failures[host] = kept
+	}
+}
+
+// Connections from the same host are counted together, whatever the port.
+func (t *Throttle) host(address net.Addr) string {
+	if address == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return address.String()
+	}
+	return host
+}